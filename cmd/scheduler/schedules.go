@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/SirClappington/enq/internal/cron"
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/jsonschema"
+	"github.com/SirClappington/enq/internal/storage"
+)
+
+type dueSchedule struct {
+	id, tenant, typ string
+	cronExpr        *string
+	intervalSec     *int
+	timezone        string
+	nextRunAt       time.Time
+	payload, config []byte
+}
+
+// fireSchedules enqueues one job per due schedule and advances next_run_at
+// in the same transaction, so a crash or restart can never fire the same
+// activation twice. Activations missed while no scheduler was running are
+// collapsed into a single run. The new jobs go to the queue through the
+// outbox, written in the same transaction.
+func fireSchedules(ctx context.Context, db *pgxpool.Pool, defaultVT int, bound time.Duration, batch int) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`select id, tenant_id, type, cron_expr, interval_sec, timezone, next_run_at,
+		        coalesce(payload, '{}'::jsonb), coalesce(config, '{}'::jsonb)
+		   from schedules
+		  where enabled and next_run_at <= now()
+		  order by next_run_at
+		  limit $1
+		  for update skip locked`, batch)
+	if err != nil {
+		return err
+	}
+	var due []dueSchedule
+	for rows.Next() {
+		var s dueSchedule
+		if err := rows.Scan(&s.id, &s.tenant, &s.typ, &s.cronExpr, &s.intervalSec, &s.timezone,
+			&s.nextRunAt, &s.payload, &s.config); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	schemas := map[string]compiledSchema{} // by tenant and type, for this batch
+	for _, s := range due {
+		spec, err := cron.FromSpec(s.cronExpr, s.intervalSec, s.timezone)
+		if err != nil {
+			log.Printf("schedule %s: %v; disabling\n", s.id, err)
+			if _, err := tx.Exec(ctx,
+				`update schedules set enabled = false, updated_at = now() where id = $1`, s.id); err != nil {
+				return err
+			}
+			continue
+		}
+		// the job type's defaults and payload contract apply as they do to
+		// jobs enqueued through the API
+		jt, err := storage.LookupJobType(ctx, tx, s.tenant, s.typ)
+		if err != nil {
+			return err
+		}
+		if err := checkPayload(jt, s.payload, schemas); err != nil {
+			log.Printf("schedule %s: %v; disabling\n", s.id, err)
+			if _, err := tx.Exec(ctx,
+				`update schedules set enabled = false, updated_at = now() where id = $1`, s.id); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := enqueueScheduled(ctx, tx, s, jt, defaultVT, bound, now); err != nil {
+			return err
+		}
+
+		next := spec.Next(s.nextRunAt)
+		if !next.IsZero() && !next.After(now) {
+			next = spec.Next(now)
+		}
+		if next.IsZero() {
+			// e.g. "0 0 30 2 *": nothing left to fire
+			if _, err := tx.Exec(ctx,
+				`update schedules set enabled = false, last_run_at = $2, updated_at = now() where id = $1`,
+				s.id, s.nextRunAt); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(ctx,
+			`update schedules set next_run_at = $2, last_run_at = $3, updated_at = now() where id = $1`,
+			s.id, next, s.nextRunAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+type compiledSchema struct {
+	sch *jsonschema.Schema
+	err error
+}
+
+// checkPayload validates a schedule's payload against its job type's
+// schema, if the type is registered with one. Schemas are compiled once
+// per type and kept in schemas, which fireSchedules scopes to a batch so
+// edits to a job type apply from the next tick.
+func checkPayload(jt *domain.JobType, payload []byte, schemas map[string]compiledSchema) error {
+	if jt == nil || jt.Schema == nil {
+		return nil
+	}
+	key := jt.TenantID + "\x00" + jt.Type
+	c, ok := schemas[key]
+	if !ok {
+		c.sch, c.err = jsonschema.Compile(jt.Schema)
+		schemas[key] = c
+	}
+	if c.err != nil {
+		return fmt.Errorf("schema for %s: %w", jt.Type, c.err)
+	}
+	violations, err := c.sch.Validate(payload)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("payload does not match the schema for %s: %v", jt.Type, violations)
+	}
+	return nil
+}
+
+// enqueueScheduled creates the job for one activation of s, ready at now.
+// The schedule's config overrides the settings of jt (nil for an
+// unregistered type).
+func enqueueScheduled(ctx context.Context, tx pgx.Tx, s dueSchedule, jt *domain.JobType, defaultVT int,
+	bound time.Duration, now time.Time) error {
+	var opts domain.ScheduleJobOptions
+	if err := json.Unmarshal(s.config, &opts); err != nil {
+		log.Printf("schedule %s: bad config, using defaults: %v\n", s.id, err)
+	}
+	priority, maxAttempts, backoff, vt := 100, 10, "exponential", defaultVT
+	if jt != nil {
+		maxAttempts, backoff, vt = jt.MaxAttempts, jt.BackoffPolicy, jt.VisibilityTimeoutSec
+	}
+	if opts.Priority != nil {
+		priority = *opts.Priority
+	}
+	if opts.MaxAttempts != nil {
+		maxAttempts = *opts.MaxAttempts
+	}
+	if opts.BackoffPolicy != nil {
+		backoff = *opts.BackoffPolicy
+	}
+	if opts.VisibilityTimeoutSec != nil {
+		vt = *opts.VisibilityTimeoutSec
+	}
+
+	// the dedupe key pins one job per activation, even if a run is retried
+	id := uuid.NewString()
+	dedupe := fmt.Sprintf("schedule:%s:%d", s.id, s.nextRunAt.Unix())
+	tag, err := tx.Exec(ctx,
+		`insert into jobs(
+id, tenant_id, type, payload, priority, run_at, claim_at, dedupe_key,
+attempt, max_attempts, backoff_policy, visibility_timeout_sec, status
+) select $1,$2,$3,$4,$5,$6,$7,$8,0,$9,$10,$11,'queued'
+   where not exists (select 1 from jobs where tenant_id = $2 and dedupe_key = $8)`,
+		id, s.tenant, s.typ, s.payload, priority, now, storage.ClaimAt(now, priority, bound),
+		dedupe, maxAttempts, backoff, vt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	meta := map[string]any{"scheduleId": s.id, "scheduledFor": s.nextRunAt, "priority": priority}
+	if err := storage.RecordEvent(ctx, tx, s.tenant, id, domain.EventEnqueued, meta); err != nil {
+		return err
+	}
+	return storage.WriteOutbox(ctx, tx, s.tenant, id)
+}
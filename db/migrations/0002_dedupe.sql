@@ -0,0 +1,7 @@
+-- +goose Up
+create index jobs_tenant_dedupe on jobs(tenant_id, dedupe_key, created_at desc)
+where dedupe_key is not null;
+
+
+-- +goose Down
+drop index if exists jobs_tenant_dedupe;
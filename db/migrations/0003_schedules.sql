@@ -0,0 +1,16 @@
+-- +goose Up
+alter table schedules
+  add column timezone text not null default 'UTC',
+  add column last_run_at timestamptz,
+  add column created_at timestamptz default now(),
+  add column updated_at timestamptz default now();
+create index schedules_due on schedules(next_run_at) where enabled;
+
+
+-- +goose Down
+drop index if exists schedules_due;
+alter table schedules
+  drop column if exists updated_at,
+  drop column if exists created_at,
+  drop column if exists last_run_at,
+  drop column if exists timezone;
@@ -0,0 +1,10 @@
+-- +goose Up
+alter table tenants add column max_concurrency int;
+alter table job_types add column max_concurrency int;
+create index jobs_tenant_leased on jobs(tenant_id, type) where status = 'leased';
+
+
+-- +goose Down
+drop index if exists jobs_tenant_leased;
+alter table job_types drop column if exists max_concurrency;
+alter table tenants drop column if exists max_concurrency;
@@ -0,0 +1,25 @@
+-- +goose Up
+create table api_keys (
+id uuid primary key,
+tenant_id text not null references tenants(id) on delete cascade,
+name text not null,
+prefix text not null,
+key_hash text not null,
+created_at timestamptz not null default now(),
+last_used_at timestamptz,
+revoked_at timestamptz
+);
+create index api_keys_prefix on api_keys(prefix) where revoked_at is null;
+create index api_keys_tenant on api_keys(tenant_id);
+
+-- carry over the single plaintext key per tenant, then stop storing it in clear
+insert into api_keys(id, tenant_id, name, prefix, key_hash)
+select gen_random_uuid(), id, 'legacy', left(api_key_hash, 12), encode(sha256(convert_to(api_key_hash, 'UTF8')), 'hex')
+  from tenants
+ where api_key_hash <> '';
+update tenants set api_key_hash = encode(sha256(convert_to(api_key_hash, 'UTF8')), 'hex');
+
+
+-- +goose Down
+-- tenants.api_key_hash stays hashed; legacy plaintext keys can't be restored
+drop table if exists api_keys;
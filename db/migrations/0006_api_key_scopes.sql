@@ -0,0 +1,8 @@
+-- +goose Up
+alter table api_keys add column scopes text[] not null default '{}';
+-- keys minted before scopes existed keep full access
+update api_keys set scopes = '{admin}';
+
+
+-- +goose Down
+alter table api_keys drop column if exists scopes;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- bumped on every lease; acks must echo it so a stale lease can't win
+alter table jobs add column lease_version bigint not null default 0;
+
+
+-- +goose Down
+alter table jobs drop column if exists lease_version;
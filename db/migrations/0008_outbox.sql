@@ -0,0 +1,16 @@
+-- +goose Up
+-- written in the same tx that makes a job ready; the scheduler's relay
+-- pushes each row to the queue once and stamps sent_at
+create table outbox (
+id bigserial primary key,
+tenant_id text not null references tenants(id) on delete cascade,
+job_id uuid not null references jobs(id) on delete cascade,
+created_at timestamptz not null default now(),
+sent_at timestamptz
+);
+create index outbox_unsent on outbox(id) where sent_at is null;
+create index outbox_sent on outbox(sent_at) where sent_at is not null;
+
+
+-- +goose Down
+drop table if exists outbox;
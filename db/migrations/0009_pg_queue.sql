@@ -0,0 +1,23 @@
+-- +goose Up
+-- QUEUE_BACKEND=postgres claims straight from jobs, most urgent first
+create index jobs_claim on jobs(tenant_id, priority desc, run_at) where status in ('queued', 'failed_temp');
+-- leases in the last second, for rate limits without Redis
+create index job_events_leased on job_events(tenant_id, created_at) where event = 'leased';
+
+-- wake blocked lease calls (LISTEN enq_ready) when a job is made ready;
+-- notifications are only delivered once the writing tx commits
+-- +goose StatementBegin
+create function outbox_notify() returns trigger language plpgsql as $$
+begin
+  perform pg_notify('enq_ready', new.tenant_id);
+  return null;
+end $$;
+-- +goose StatementEnd
+create trigger outbox_notify after insert on outbox for each row execute function outbox_notify();
+
+
+-- +goose Down
+drop trigger if exists outbox_notify on outbox;
+drop function if exists outbox_notify();
+drop index if exists job_events_leased;
+drop index if exists jobs_claim;
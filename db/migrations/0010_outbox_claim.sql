@@ -0,0 +1,8 @@
+-- +goose Up
+-- a relay claims a batch for a while and publishes it outside any tx;
+-- rows of a relay that died mid-batch are claimable again once it runs out
+alter table outbox add column claimed_until timestamptz;
+
+
+-- +goose Down
+alter table outbox drop column if exists claimed_until;
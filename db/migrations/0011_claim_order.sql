@@ -0,0 +1,10 @@
+-- +goose Up
+-- claims order by run_at less a priority head start (queue.ReadyScore), so
+-- the scan walks run_at rather than priority
+drop index if exists jobs_claim;
+create index jobs_claim on jobs(tenant_id, run_at) where status in ('queued', 'failed_temp');
+
+
+-- +goose Down
+drop index if exists jobs_claim;
+create index jobs_claim on jobs(tenant_id, priority desc, run_at) where status in ('queued', 'failed_temp');
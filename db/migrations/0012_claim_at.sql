@@ -0,0 +1,15 @@
+-- +goose Up
+-- claim_at stores the claim order (storage.ClaimAt) so the scan walks
+-- jobs_claim instead of sorting every ready job; updates that move run_at
+-- keep the head start. Existing rows get the default 300s bound.
+alter table jobs add column claim_at timestamptz;
+update jobs set claim_at = run_at - make_interval(secs => 300 * least(greatest(priority, 0), 1000) / 1000.0);
+alter table jobs alter column claim_at set not null;
+drop index if exists jobs_claim;
+create index jobs_claim on jobs(tenant_id, claim_at, id) where status in ('queued', 'failed_temp');
+
+
+-- +goose Down
+drop index if exists jobs_claim;
+create index jobs_claim on jobs(tenant_id, run_at) where status in ('queued', 'failed_temp');
+alter table jobs drop column if exists claim_at;
@@ -1,20 +1,22 @@
 import fetch from 'node-fetch'
 const API = process.env.API || 'http://localhost:8080'
 const KEY = process.env.KEY
+const WORKER = process.env.WORKER || 'node-worker-1'
 
 
 async function loop(){
 while(true){
-const res = await fetch(`${API}/v1/lease`, {method:'POST', headers:{'Authorization':`Bearer ${KEY}`}})
+const res = await fetch(`${API}/v1/lease`, {method:'POST', headers:{'Authorization':`Bearer ${KEY}`,'Content-Type':'application/json'}, body:JSON.stringify({workerId:WORKER, waitSec:20})})
 if(res.status!==200){ await sleep(1000); continue }
 const { job } = await res.json()
-if(!job){ await sleep(500); continue }
+// long poll: no job means waitSec passed with nothing to do
+if(!job) continue
 try {
 // do work
 await sleep(500)
-await fetch(`${API}/v1/complete`, {method:'POST', headers:{'Authorization':`Bearer ${KEY}`,'Content-Type':'application/json'}, body:JSON.stringify({jobId:job.id})})
+await fetch(`${API}/v1/complete`, {method:'POST', headers:{'Authorization':`Bearer ${KEY}`,'Content-Type':'application/json'}, body:JSON.stringify({workerId:WORKER, jobId:job.id, leaseVersion:job.leaseVersion})})
 } catch(e){
-await fetch(`${API}/v1/fail`, {method:'POST', headers:{'Authorization':`Bearer ${KEY}`,'Content-Type':'application/json'}, body:JSON.stringify({jobId:job.id, error:String(e), retryable:true})})
+await fetch(`${API}/v1/fail`, {method:'POST', headers:{'Authorization':`Bearer ${KEY}`,'Content-Type':'application/json'}, body:JSON.stringify({workerId:WORKER, jobId:job.id, leaseVersion:job.leaseVersion, error:String(e), retryable:true})})
 }
 }
 }
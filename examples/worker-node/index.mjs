@@ -14,7 +14,7 @@ async function loop() {
       const leaseRes = await fetch(`${API}/v1/lease`, {
         method: "POST",
         headers: { "Authorization": `Bearer ${KEY}`, "Content-Type": "application/json" },
-        body: JSON.stringify({ workerId: "node-worker-1", capabilities: ["email.send"], maxBatch: 1 })
+        body: JSON.stringify({ workerId: "node-worker-1", capabilities: ["email.send"], maxBatch: 1, waitSec: 20 })
       });
 
       if (!leaseRes.ok) {
@@ -25,7 +25,8 @@ async function loop() {
       }
 
       const data = await safeJSON(leaseRes);
-      if (!data || !data.job) { await sleep(300); continue; }
+      // long poll: an empty lease means waitSec passed with nothing to do
+      if (!data || !data.job) continue;
 
       const job = data.job;
       console.log("Leased:", job.id, job.type);
@@ -36,7 +37,7 @@ async function loop() {
         const failRes = await fetch(`${API}/v1/fail`, {
           method: "POST",
           headers: { "Authorization": `Bearer ${KEY}`, "Content-Type": "application/json" },
-          body: JSON.stringify({ workerId: "node-worker-1", jobId: job.id, error: "random fail", retryable: true })
+          body: JSON.stringify({ workerId: "node-worker-1", jobId: job.id, leaseVersion: job.leaseVersion, error: "random fail", retryable: true })
         });
         console.log("Failed (retry scheduled):", job.id, failRes.status);
         continue;
@@ -45,7 +46,7 @@ async function loop() {
       const done = await fetch(`${API}/v1/complete`, {
         method: "POST",
         headers: { "Authorization": `Bearer ${KEY}`, "Content-Type": "application/json" },
-        body: JSON.stringify({ workerId: "node-worker-1", jobId: job.id })
+        body: JSON.stringify({ workerId: "node-worker-1", jobId: job.id, leaseVersion: job.leaseVersion })
       });
       console.log(done.ok ? "Completed:" : "Complete HTTP "+done.status, job.id);
     } catch (e) {
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/SirClappington/enq/internal/auth"
+)
+
+type ctxKey int
+
+const (
+	tenantKey ctxKey = iota
+	scopesKey
+	apiKeyIDKey
+)
+
+func setTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantID)
+}
+
+func setScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey, scopes)
+}
+
+// getAPIKeyID returns the API key the request authenticated with; it is
+// unset for JWTs.
+func getAPIKeyID(ctx context.Context) (string, bool) {
+	s, ok := ctx.Value(apiKeyIDKey).(string)
+	return s, ok && s != ""
+}
+
+func getTenant(ctx context.Context) (string, bool) {
+	v := ctx.Value(tenantKey)
+	if v == nil {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok && s != ""
+}
+
+// requireScope rejects requests whose credential lacks scope.
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted, _ := r.Context().Value(scopesKey).([]string)
+			if !auth.HasScope(granted, scope) {
+				writeUnauthorized(w, "insufficient_scope", "requires scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if h == "" {
+		return "", false
+	}
+	const p = "Bearer "
+	if len(h) <= len(p) || h[:len(p)] != p {
+		return "", false
+	}
+	return h[len(p):], true
+}
+
+// tenantForKey looks up the tenant, key ID and scopes for a given API key. Keys are
+// found by their public prefix and checked against the stored SHA-256;
+// revoked keys never match. "dev-key" maps to the "demo" tenant with every
+// scope, but only when allowDev is set (APP_ENV=local). Without a db only
+// the dev key is accepted.
+func tenantForKey(ctx context.Context, db DB, apiKey string, allowDev bool) (string, string, []string, bool) {
+	if allowDev && apiKey == "dev-key" {
+		return "demo", "dev-key", []string{auth.ScopeAdmin}, true
+	}
+	if db == nil {
+		return "", "", nil, false
+	}
+	rows, err := db.Query(ctx,
+		`select id::text, tenant_id, key_hash, scopes from api_keys where prefix = $1 and revoked_at is null`,
+		auth.KeyPrefix(apiKey))
+	if err != nil {
+		return "", "", nil, false
+	}
+	var keyID, tenantID string
+	var scopes []string
+	for rows.Next() {
+		var id, tenant, hash string
+		var sc []string
+		if err := rows.Scan(&id, &tenant, &hash, &sc); err != nil {
+			rows.Close()
+			return "", "", nil, false
+		}
+		if auth.KeyMatches(apiKey, hash) {
+			keyID, tenantID, scopes = id, tenant, sc
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil || tenantID == "" {
+		return "", "", nil, false
+	}
+	// last_used_at is informational; a minute of slack saves a write per request
+	_, _ = db.Exec(ctx,
+		`update api_keys set last_used_at = now()
+		  where id = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute')`, keyID)
+	return tenantID, keyID, scopes, true
+}
+
+// RFC 6750-ish 401 writer
+func writeUnauthorized(w http.ResponseWriter, errCode, desc string) {
+	// errCode: "invalid_request" | "invalid_token" | "insufficient_scope" | ""
+	// desc: short human message (optional)
+	h := `Bearer realm="enq", charset="UTF-8"`
+	if errCode != "" {
+		h += `, error="` + errCode + `"`
+	}
+	if desc != "" {
+		h += `, error_description="` + desc + `"`
+	}
+	w.Header().Set("WWW-Authenticate", h)
+	code := errCode
+	if code == "" || code == "Unauthorized" {
+		code = codeUnauthorized
+	}
+	if desc == "" {
+		desc = "unauthorized"
+	}
+	writeError(w, http.StatusUnauthorized, code, desc)
+}
+
+// authenticate resolves the tenant and scopes from a bearer API key or JWT.
+// CORS preflights pass through.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, ok := bearerToken(r)
+		if !ok {
+			writeUnauthorized(w, "invalid_request", "missing or malformed Authorization header")
+			return
+		}
+		if auth.LooksLikeJWT(key) {
+			claims, err := s.jwts.Verify(key, time.Now())
+			if err != nil {
+				writeUnauthorized(w, "invalid_token", err.Error())
+				return
+			}
+			ctx := setScopes(setTenant(r.Context(), claims.Tenant), claims.Scopes())
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		tenantID, keyID, scopes, ok := tenantForKey(r.Context(), s.db, key, s.cfg.Local())
+		if !ok {
+			writeUnauthorized(w, "invalid_token", "invalid API key")
+			return
+		}
+		ctx := setScopes(setTenant(r.Context(), tenantID), scopes)
+		ctx = context.WithValue(ctx, apiKeyIDKey, keyID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/storage"
+)
+
+type DeadLetter struct {
+	JobID       string          `json:"jobId"`
+	Type        string          `json:"type"`
+	Reason      string          `json:"reason"`
+	Error       *string         `json:"error"`
+	Attempt     int             `json:"attempt"`
+	MaxAttempts int             `json:"maxAttempts"`
+	ParkedAt    time.Time       `json:"parkedAt"`
+	Payload     json.RawMessage `json:"payload,omitempty"` // only on single-entry reads
+}
+
+type DLQBatchReq struct {
+	JobIDs []string `json:"jobIds"`
+}
+
+// mountDLQ registers the tenant-scoped dead-letter endpoints:
+//
+//	GET    /v1/dlq             list parked jobs (newest first)
+//	GET    /v1/dlq/{id}        inspect one entry, payload included
+//	POST   /v1/dlq/replay      {"jobIds":[...]} requeue with attempts reset
+//	POST   /v1/dlq/purge       {"jobIds":[...]} delete jobs and their entries
+//	DELETE /v1/dlq/{id}        purge one
+func mountDLQ(r chi.Router, db DB) {
+	r.Get("/v1/dlq", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		rows, err := db.Query(req.Context(),
+			`select d.job_id::text, j.type, coalesce(d.reason, ''), j.error, j.attempt, j.max_attempts, d.parked_at
+			   from dead_letters d join jobs j on j.id = d.job_id
+			  where d.tenant_id = $1
+			  order by d.parked_at desc
+			  limit 100`, tenantID)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		defer rows.Close()
+
+		out := []DeadLetter{}
+		for rows.Next() {
+			var d DeadLetter
+			if err := rows.Scan(&d.JobID, &d.Type, &d.Reason, &d.Error, &d.Attempt, &d.MaxAttempts, &d.ParkedAt); err != nil {
+				writeInternal(w, err)
+				return
+			}
+			out = append(out, d)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"deadLetters": out})
+	})
+
+	r.Get("/v1/dlq/{id}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		var d DeadLetter
+		err := db.QueryRow(req.Context(),
+			`select d.job_id::text, j.type, coalesce(d.reason, ''), j.error, j.attempt, j.max_attempts, d.parked_at, j.payload
+			   from dead_letters d join jobs j on j.id = d.job_id
+			  where d.job_id::text = $1 and d.tenant_id = $2`,
+			chi.URLParam(req, "id"), tenantID).
+			Scan(&d.JobID, &d.Type, &d.Reason, &d.Error, &d.Attempt, &d.MaxAttempts, &d.ParkedAt, &d.Payload)
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDeadLetterNotFound, "dead letter not found")
+			return
+		}
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d)
+	})
+
+	r.Post("/v1/dlq/replay", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		var body DLQBatchReq
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if len(body.JobIDs) == 0 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "jobIds is required")
+			return
+		}
+
+		tx, err := db.Begin(req.Context())
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		defer tx.Rollback(req.Context())
+
+		rows, err := tx.Query(req.Context(),
+			`with parked as (
+			   delete from dead_letters
+			    where job_id::text = any($1) and tenant_id = $2
+			   returning job_id)
+			 update jobs j
+			    set status='queued', attempt=0, error=null,
+			        run_at=now(), claim_at=now() - (run_at - claim_at),
+			        leased_by=null, lease_expires_at=null, updated_at=now()
+			   from parked
+			  where j.id = parked.job_id
+			 returning j.id::text`,
+			body.JobIDs, tenantID)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				writeInternal(w, err)
+				return
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			writeInternal(w, err)
+			return
+		}
+		for _, id := range ids {
+			if err := storage.RecordEvent(req.Context(), tx, tenantID, id, domain.EventReplayed, nil); err != nil {
+				writeInternal(w, err)
+				return
+			}
+			// the scheduler's outbox relay pushes it to the queue
+			if err := storage.WriteOutbox(req.Context(), tx, tenantID, id); err != nil {
+				writeInternal(w, err)
+				return
+			}
+		}
+		if err := tx.Commit(req.Context()); err != nil {
+			writeInternal(w, err)
+			return
+		}
+		if ids == nil {
+			ids = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"replayed": ids})
+	})
+
+	purge := func(ctx context.Context, tenantID string, jobIDs []string) (int64, error) {
+		// dead_letters rows go with the job via on delete cascade
+		tag, err := db.Exec(ctx,
+			`delete from jobs
+			  where id::text = any($1) and tenant_id = $2 and status = 'dead_lettered'`,
+			jobIDs, tenantID)
+		return tag.RowsAffected(), err
+	}
+
+	r.Post("/v1/dlq/purge", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		var body DLQBatchReq
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if len(body.JobIDs) == 0 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "jobIds is required")
+			return
+		}
+		n, err := purge(req.Context(), tenantID, body.JobIDs)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"purged": n})
+	})
+
+	r.Delete("/v1/dlq/{id}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+		n, err := purge(req.Context(), tenantID, []string{chi.URLParam(req, "id")})
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		if n == 0 {
+			writeError(w, http.StatusNotFound, codeDeadLetterNotFound, "dead letter not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"purged": n})
+	})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/SirClappington/enq/internal/storage"
+)
+
+// Error codes returned in ErrorBody.Code. They are part of the API: clients
+// switch on them, so existing codes must not change meaning. See
+// docs/errors.md.
+const (
+	codeBadRequest         = "bad_request"       // 400 malformed JSON or invalid field
+	codeValidationFailed   = "validation_failed" // 422 payload rejected by the job type schema
+	codePayloadTooLarge    = "payload_too_large" // 413 request body over the size limit
+	codeUnauthorized       = "unauthorized"      // 401 (also invalid_request, invalid_token, insufficient_scope)
+	codeNotFound           = "not_found"         // 404 no such route
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeJobNotFound        = "job_not_found"
+	codeJobTypeNotFound    = "job_type_not_found"
+	codeScheduleNotFound   = "schedule_not_found"
+	codeKeyNotFound        = "key_not_found"
+	codeDeadLetterNotFound = "dead_letter_not_found"
+	codeLeaseLost          = "lease_lost"     // 409 job re-leased under another version
+	codeJobNotLeased       = "job_not_leased" // 409 job finished or went back to the queue
+	codeUnavailable        = "unavailable"    // 503 feature disabled by configuration
+	codeInternal           = "internal"       // 500 details are only logged server-side
+)
+
+type ErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	Details   any    `json:"details,omitempty"`
+}
+
+type ErrorResp struct {
+	Error ErrorBody `json:"error"`
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// requestID tags every request with an ID, echoed in the X-Request-ID
+// response header and in error bodies. A caller-supplied ID is kept.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeError sends the JSON error envelope.
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeErrorDetails(w, status, code, msg, nil)
+}
+
+func writeErrorDetails(w http.ResponseWriter, status int, code, msg string, details any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorResp{Error: ErrorBody{
+		Code: code, Message: msg, RequestID: w.Header().Get(requestIDHeader), Details: details,
+	}})
+}
+
+// writeInternal logs err and sends a 500 that doesn't leak it.
+func writeInternal(w http.ResponseWriter, err error) {
+	id := w.Header().Get(requestIDHeader)
+	log.Printf("request %s: %v", id, err)
+	writeError(w, http.StatusInternalServerError, codeInternal, "internal error (request "+id+")")
+}
+
+// writeAckError maps a failed extend/complete/fail: 404 if the job doesn't
+// exist for the tenant, 409 if the caller no longer holds its lease.
+func writeAckError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, codeJobNotFound, err.Error())
+	case errors.Is(err, storage.ErrLeaseLost):
+		writeError(w, http.StatusConflict, codeLeaseLost, err.Error())
+	case errors.Is(err, storage.ErrNotLeased):
+		writeError(w, http.StatusConflict, codeJobNotLeased, err.Error())
+	default:
+		writeInternal(w, err)
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SirClappington/enq/internal/retry"
+	"github.com/SirClappington/enq/internal/storage"
+)
+
+type EnqueueReq struct {
+	Type                 string          `json:"type"`
+	Payload              json.RawMessage `json:"payload"`
+	RunAt                *time.Time      `json:"runAt"`
+	Priority             *int            `json:"priority"`     // 0..1000, higher is leased first
+	DedupeKey            *string         `json:"dedupeKey"`    // repeat enqueues with this key return the first job
+	DedupeTtlSec         *int            `json:"dedupeTtlSec"` // how long the key is held; unset = forever
+	MaxAttempts          *int            `json:"maxAttempts"`
+	BackoffPolicy        *string         `json:"backoffPolicy"` // see internal/retry, e.g. "exponential:5s,max=1h,jitter=full"
+	VisibilityTimeoutSec *int            `json:"visibilityTimeoutSec"`
+}
+
+// maxEnqueueBody caps an enqueue request, payload included, so a single
+// request can't make the schema check or the insert arbitrarily expensive.
+const maxEnqueueBody = 1 << 20
+
+// enqueue handles POST /v1/jobs.
+func (s *Server) enqueue(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := getTenant(req.Context())
+	if !ok {
+		writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+		return
+	}
+
+	var body EnqueueReq
+	req.Body = http.MaxBytesReader(w, req.Body, maxEnqueueBody)
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+				fmt.Sprintf("request body is over %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	if body.Type == "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "type is required")
+		return
+	}
+	if len(body.Payload) == 0 {
+		body.Payload = json.RawMessage(`{}`)
+	}
+
+	// registered job types supply defaults and a payload contract
+	jt, err := s.repo.JobType(req.Context(), tenantID, body.Type)
+	if err != nil {
+		writeInternal(w, err)
+		return
+	}
+	maxAttempts, backoff, vt := 10, "exponential", s.cfg.DefaultVisibilityTOSec
+	if jt != nil {
+		maxAttempts, backoff, vt = jt.MaxAttempts, jt.BackoffPolicy, jt.VisibilityTimeoutSec
+		if jt.Schema != nil {
+			sch, err := s.schemas.get(tenantID, body.Type, jt.Schema)
+			if err != nil {
+				writeInternal(w, err)
+				return
+			}
+			violations, err := sch.Validate(body.Payload)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+				return
+			}
+			if len(violations) > 0 {
+				writeErrorDetails(w, http.StatusUnprocessableEntity, codeValidationFailed,
+					"payload does not match the schema for "+body.Type, map[string]any{"violations": violations})
+				return
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	runAt := now
+	if body.RunAt != nil {
+		runAt = *body.RunAt
+	}
+	priority := 100
+	if body.Priority != nil {
+		priority = *body.Priority
+	}
+	if body.MaxAttempts != nil {
+		maxAttempts = *body.MaxAttempts
+	}
+	if body.BackoffPolicy != nil {
+		backoff = *body.BackoffPolicy
+	}
+	if _, err := retry.Parse(backoff); err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "invalid backoffPolicy: "+err.Error())
+		return
+	}
+	if body.VisibilityTimeoutSec != nil {
+		vt = *body.VisibilityTimeoutSec
+	}
+
+	id, dup, err := s.repo.InsertJob(req.Context(), &storage.InsertJobParams{
+		TenantID: tenantID, Type: body.Type, Payload: body.Payload,
+		Priority: priority, RunAt: runAt, DedupeKey: body.DedupeKey,
+		DedupeTTL: body.DedupeTtlSec, MaxAttempts: maxAttempts,
+		BackoffPolicy: backoff, VisibilityTimeoutSec: vt,
+	})
+	if err != nil {
+		writeInternal(w, err)
+		return
+	}
+	if dup {
+		// same dedupeKey within its TTL: hand back the original job
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "duplicate": true})
+		return
+	}
+
+	// the scheduler's outbox relay pushes it to the queue
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "status": "queued"})
+}
+
+// listJobs handles GET /v1/jobs (newest 50).
+func (s *Server) listJobs(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := getTenant(req.Context())
+	if !ok {
+		writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+		return
+	}
+
+	type row struct {
+		ID      string          `json:"id"`
+		Type    string          `json:"type"`
+		Status  string          `json:"status"`
+		Attempt int             `json:"attempt"`
+		RunAt   time.Time       `json:"run_at"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	jobs, err := s.repo.ListJobs(req.Context(), tenantID, 50)
+	if err != nil {
+		writeInternal(w, err)
+		return
+	}
+	var out []row
+	for _, j := range jobs {
+		out = append(out, row{ID: j.ID, Type: j.Type, Status: string(j.Status), Attempt: j.Attempt, RunAt: j.RunAt, Payload: j.Payload})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"jobs": out})
+}
+
+// jobEvents handles GET /v1/jobs/{id}/events.
+func (s *Server) jobEvents(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := getTenant(req.Context())
+	if !ok {
+		writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+		return
+	}
+
+	type event struct {
+		ID        int64           `json:"id"`
+		Event     string          `json:"event"`
+		Metadata  json.RawMessage `json:"metadata"`
+		CreatedAt time.Time       `json:"createdAt"`
+	}
+	events, err := s.repo.JobEvents(req.Context(), tenantID, chi.URLParam(req, "id"))
+	if errors.Is(err, storage.ErrJobNotFound) {
+		writeError(w, http.StatusNotFound, codeJobNotFound, "job not found")
+		return
+	}
+	if err != nil {
+		writeInternal(w, err)
+		return
+	}
+	out := make([]event, 0, len(events))
+	for _, e := range events {
+		out = append(out, event{ID: e.ID, Event: string(e.Event), Metadata: e.Metadata, CreatedAt: e.CreatedAt})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"events": out})
+}
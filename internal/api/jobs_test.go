@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/queue"
+)
+
+// newHandlerEnv serves the API on storage.Memory and queue.Memory.
+func newHandlerEnv(t *testing.T) *testEnv {
+	return newTestEnv(t, memoryBackend(queue.NewMemory(testBound)))
+}
+
+func TestEnqueue(t *testing.T) {
+	e := newHandlerEnv(t)
+	var resp struct{ ID, Status string }
+	if code := e.do("POST", "/v1/jobs", EnqueueReq{Type: "email"}, &resp); code != http.StatusCreated {
+		t.Fatalf("status %d", code)
+	}
+	if resp.ID == "" || resp.Status != "queued" {
+		t.Errorf("response = %+v", resp)
+	}
+
+	bad := "linear"
+	tests := []struct {
+		name string
+		body any
+		want string
+	}{
+		{"malformed json", `{"type":`, "unexpected EOF"},
+		{"no type", EnqueueReq{}, "type is required"},
+		{"bad backoff policy", EnqueueReq{Type: "email", BackoffPolicy: &bad}, "invalid backoffPolicy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := e.doErr("POST", "/v1/jobs", tt.body)
+			if code != http.StatusBadRequest || body.Code != codeBadRequest {
+				t.Errorf("status %d, code %q", code, body.Code)
+			}
+			if !strings.Contains(body.Message, tt.want) {
+				t.Errorf("message %q, want one containing %q", body.Message, tt.want)
+			}
+		})
+	}
+
+	big := `{"type":"email","payload":"` + strings.Repeat("x", maxEnqueueBody) + `"}`
+	if code, body := e.doErr("POST", "/v1/jobs", big); code != http.StatusRequestEntityTooLarge || body.Code != codePayloadTooLarge {
+		t.Errorf("oversized body: status %d, code %q", code, body.Code)
+	}
+}
+
+func TestEnqueueUnauthorized(t *testing.T) {
+	e := newHandlerEnv(t)
+	if rec := e.call("", "POST", "/v1/jobs", EnqueueReq{Type: "email"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no credentials: status %d", rec.Code)
+	}
+	if rec := e.call("not-a-key", "POST", "/v1/jobs", EnqueueReq{Type: "email"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d", rec.Code)
+	}
+	// APP_ENV=local: the dev key is the demo tenant's admin
+	if rec := e.call("dev-key", "POST", "/v1/jobs", EnqueueReq{Type: "email"}); rec.Code != http.StatusCreated {
+		t.Errorf("dev key: status %d", rec.Code)
+	}
+}
+
+func TestEnqueueJobTypeDefaults(t *testing.T) {
+	e := newHandlerEnv(t)
+	e.putJobType(t, domain.JobType{TenantID: e.tenant, Type: "email", MaxAttempts: 3,
+		BackoffPolicy: "fixed:5s", VisibilityTimeoutSec: 30})
+	e.enqueue(EnqueueReq{Type: "email"})
+	seven := 7
+	e.enqueue(EnqueueReq{Type: "email", MaxAttempts: &seven})
+
+	jobs := e.lease(LeaseReq{MaxBatch: 2})
+	if len(jobs) != 2 {
+		t.Fatalf("leased %d jobs", len(jobs))
+	}
+	got := map[int]int{}
+	for _, j := range jobs {
+		got[j.MaxAttempts] = j.VisibilityTimeoutSec
+	}
+	// the job type's defaults, and a request's own maxAttempts over them
+	if got[3] != 30 || got[7] != 30 {
+		t.Errorf("maxAttempts -> visibility timeout = %v", got)
+	}
+}
+
+func TestEnqueueSchema(t *testing.T) {
+	e := newHandlerEnv(t)
+	e.putJobType(t, domain.JobType{TenantID: e.tenant, Type: "resize", MaxAttempts: 10,
+		BackoffPolicy: "exponential", VisibilityTimeoutSec: 60,
+		Schema: []byte(`{"type":"object","required":["width"],"properties":{"width":{"type":"integer","minimum":1}}}`)})
+
+	code, body := e.doErr("POST", "/v1/jobs", map[string]any{"type": "resize", "payload": map[string]any{"width": 0}})
+	if code != http.StatusUnprocessableEntity || body.Code != codeValidationFailed {
+		t.Fatalf("status %d, code %q", code, body.Code)
+	}
+	details, _ := body.Details.(map[string]any)
+	if v, _ := details["violations"].([]any); len(v) != 1 {
+		t.Errorf("details = %v, want one violation", body.Details)
+	}
+	if code := e.do("POST", "/v1/jobs", map[string]any{"type": "resize", "payload": map[string]any{"width": 640}}, nil); code != http.StatusCreated {
+		t.Errorf("valid payload: status %d", code)
+	}
+}
+
+func TestEnqueueDedupe(t *testing.T) {
+	e := newHandlerEnv(t)
+	key := "order-42"
+	var first, second struct {
+		ID        string
+		Duplicate bool
+	}
+	if code := e.do("POST", "/v1/jobs", EnqueueReq{Type: "email", DedupeKey: &key}, &first); code != http.StatusCreated {
+		t.Fatalf("first enqueue: status %d", code)
+	}
+	if code := e.do("POST", "/v1/jobs", EnqueueReq{Type: "email", DedupeKey: &key}, &second); code != http.StatusOK {
+		t.Fatalf("second enqueue: status %d", code)
+	}
+	if !second.Duplicate || second.ID != first.ID {
+		t.Errorf("second enqueue = %+v, want a duplicate of %s", second, first.ID)
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	e := newHandlerEnv(t)
+	id := e.enqueue(EnqueueReq{Type: "email"})
+	e.complete(e.lease(LeaseReq{})[0])
+
+	var resp struct {
+		Events []struct{ Event string }
+	}
+	if code := e.do("GET", "/v1/jobs/"+id+"/events", nil, &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	var got []string
+	for _, ev := range resp.Events {
+		got = append(got, ev.Event)
+	}
+	if want := []string{"enqueued", "leased", "completed"}; !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	if code, body := e.doErr("GET", "/v1/jobs/00000000-0000-0000-0000-000000000000/events", nil); code != http.StatusNotFound || body.Code != codeJobNotFound {
+		t.Errorf("unknown job: status %d, code %q", code, body.Code)
+	}
+}
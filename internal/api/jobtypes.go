@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/SirClappington/enq/internal/config"
+	"github.com/SirClappington/enq/internal/jsonschema"
+	"github.com/SirClappington/enq/internal/retry"
+)
+
+type JobTypeReq struct {
+	MaxAttempts          *int            `json:"maxAttempts"`
+	BackoffPolicy        *string         `json:"backoffPolicy"`
+	VisibilityTimeoutSec *int            `json:"visibilityTimeoutSec"`
+	Schema               json.RawMessage `json:"schema"`         // JSON Schema for payloads; omit to accept any
+	RateLimitKey         *string         `json:"rateLimitKey"`   // types with the same key share one limit
+	RateLimitQPS         *int            `json:"rateLimitQps"`   // max leases per second; omit for unlimited
+	MaxConcurrency       *int            `json:"maxConcurrency"` // max jobs leased at once; omit for unlimited
+}
+
+type JobType struct {
+	Type                 string          `json:"type"`
+	MaxAttempts          int             `json:"maxAttempts"`
+	BackoffPolicy        string          `json:"backoffPolicy"`
+	VisibilityTimeoutSec int             `json:"visibilityTimeoutSec"`
+	Schema               json.RawMessage `json:"schema,omitempty"`
+	RateLimitKey         *string         `json:"rateLimitKey,omitempty"`
+	RateLimitQPS         *int            `json:"rateLimitQps,omitempty"`
+	MaxConcurrency       *int            `json:"maxConcurrency,omitempty"`
+}
+
+const jobTypeCols = `type, max_attempts, backoff_policy, visibility_timeout_sec, schema, rate_limit_key, rate_limit_qps, max_concurrency`
+
+func scanJobType(row pgx.Row) (JobType, error) {
+	var jt JobType
+	err := row.Scan(&jt.Type, &jt.MaxAttempts, &jt.BackoffPolicy, &jt.VisibilityTimeoutSec, &jt.Schema,
+		&jt.RateLimitKey, &jt.RateLimitQPS, &jt.MaxConcurrency)
+	return jt, err
+}
+
+// mountJobTypes registers tenant-scoped job type management. Enqueue uses a
+// registered type's settings as defaults and validates payloads against its
+// schema.
+//
+//	PUT    /v1/job-types/{type}   register or replace
+//	GET    /v1/job-types
+//	GET    /v1/job-types/{type}
+//	DELETE /v1/job-types/{type}
+func mountJobTypes(r chi.Router, db DB, cfg config.Config, schemas *schemaCache) {
+	r.Put("/v1/job-types/{type}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		var body JobTypeReq
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		jt := JobType{
+			Type: chi.URLParam(req, "type"), MaxAttempts: 10,
+			BackoffPolicy: "exponential", VisibilityTimeoutSec: cfg.DefaultVisibilityTOSec,
+			RateLimitKey: body.RateLimitKey, RateLimitQPS: body.RateLimitQPS,
+			MaxConcurrency: body.MaxConcurrency,
+		}
+		if body.MaxAttempts != nil {
+			jt.MaxAttempts = *body.MaxAttempts
+		}
+		if body.BackoffPolicy != nil {
+			jt.BackoffPolicy = *body.BackoffPolicy
+		}
+		if body.VisibilityTimeoutSec != nil {
+			jt.VisibilityTimeoutSec = *body.VisibilityTimeoutSec
+		}
+		if jt.MaxAttempts < 1 || jt.VisibilityTimeoutSec < 1 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "maxAttempts and visibilityTimeoutSec must be positive")
+			return
+		}
+		if jt.RateLimitQPS != nil && *jt.RateLimitQPS < 1 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "rateLimitQps must be positive")
+			return
+		}
+		if jt.MaxConcurrency != nil && *jt.MaxConcurrency < 1 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "maxConcurrency must be positive")
+			return
+		}
+		if _, err := retry.Parse(jt.BackoffPolicy); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "invalid backoffPolicy: "+err.Error())
+			return
+		}
+		var schema []byte
+		if len(body.Schema) > 0 && string(body.Schema) != "null" {
+			if _, err := jsonschema.Compile(body.Schema); err != nil {
+				writeError(w, http.StatusBadRequest, codeBadRequest, "invalid schema: "+err.Error())
+				return
+			}
+			schema = body.Schema
+		}
+
+		jt, err := scanJobType(db.QueryRow(req.Context(),
+			`insert into job_types(tenant_id, type, max_attempts, backoff_policy, visibility_timeout_sec, schema,
+			                       rate_limit_key, rate_limit_qps, max_concurrency)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			 on conflict (tenant_id, type) do update
+			    set max_attempts = excluded.max_attempts,
+			        backoff_policy = excluded.backoff_policy,
+			        visibility_timeout_sec = excluded.visibility_timeout_sec,
+			        schema = excluded.schema,
+			        rate_limit_key = excluded.rate_limit_key,
+			        rate_limit_qps = excluded.rate_limit_qps,
+			        max_concurrency = excluded.max_concurrency
+			 returning `+jobTypeCols,
+			tenantID, jt.Type, jt.MaxAttempts, jt.BackoffPolicy, jt.VisibilityTimeoutSec, schema,
+			jt.RateLimitKey, jt.RateLimitQPS, jt.MaxConcurrency))
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		schemas.forget(tenantID, jt.Type)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jt)
+	})
+
+	r.Get("/v1/job-types", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		rows, err := db.Query(req.Context(),
+			`select `+jobTypeCols+` from job_types where tenant_id = $1 order by type`, tenantID)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		defer rows.Close()
+
+		out := []JobType{}
+		for rows.Next() {
+			jt, err := scanJobType(rows)
+			if err != nil {
+				writeInternal(w, err)
+				return
+			}
+			out = append(out, jt)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"jobTypes": out})
+	})
+
+	r.Get("/v1/job-types/{type}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		jt, err := scanJobType(db.QueryRow(req.Context(),
+			`select `+jobTypeCols+` from job_types where tenant_id = $1 and type = $2`,
+			tenantID, chi.URLParam(req, "type")))
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeJobTypeNotFound, "job type not found")
+			return
+		}
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jt)
+	})
+
+	r.Delete("/v1/job-types/{type}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		tag, err := db.Exec(req.Context(),
+			`delete from job_types where tenant_id = $1 and type = $2`,
+			tenantID, chi.URLParam(req, "type"))
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		schemas.forget(tenantID, chi.URLParam(req, "type"))
+		if tag.RowsAffected() == 0 {
+			writeError(w, http.StatusNotFound, codeJobTypeNotFound, "job type not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
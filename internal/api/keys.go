@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/SirClappington/enq/internal/auth"
+)
+
+type APIKeyReq struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"` // see internal/auth, e.g. ["jobs:write"]
+}
+
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Key        string     `json:"key,omitempty"` // only returned when minted
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+const apiKeyCols = `id::text, name, prefix, scopes, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (APIKey, error) {
+	var k APIKey
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt)
+	return k, err
+}
+
+// mountKeys registers API key management for the caller's tenant. Only the
+// SHA-256 of a key is stored, so the plaintext is returned once, on mint.
+//
+//	POST   /v1/admin/keys        mint
+//	GET    /v1/admin/keys
+//	DELETE /v1/admin/keys/{id}   revoke
+func mountKeys(r chi.Router, db DB) {
+	r.Post("/v1/admin/keys", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		var body APIKeyReq
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if body.Name == "" {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "name is required")
+			return
+		}
+		if err := auth.ValidateScopes(body.Scopes); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		key, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+
+		k, err := scanAPIKey(db.QueryRow(req.Context(),
+			`insert into api_keys(id, tenant_id, name, prefix, key_hash, scopes)
+			 values ($1, $2, $3, $4, $5, $6)
+			 returning `+apiKeyCols,
+			uuid.NewString(), tenantID, body.Name, prefix, hash, body.Scopes))
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		k.Key = key
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(k)
+	})
+
+	r.Get("/v1/admin/keys", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		rows, err := db.Query(req.Context(),
+			`select `+apiKeyCols+` from api_keys where tenant_id = $1 order by created_at`, tenantID)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		defer rows.Close()
+
+		out := []APIKey{}
+		for rows.Next() {
+			k, err := scanAPIKey(rows)
+			if err != nil {
+				writeInternal(w, err)
+				return
+			}
+			out = append(out, k)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": out})
+	})
+
+	r.Delete("/v1/admin/keys/{id}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		tag, err := db.Exec(req.Context(),
+			`update api_keys set revoked_at = coalesce(revoked_at, now())
+			  where id::text = $1 and tenant_id = $2`,
+			chi.URLParam(req, "id"), tenantID)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeError(w, http.StatusNotFound, codeKeyNotFound, "key not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
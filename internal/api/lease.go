@@ -0,0 +1,328 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/queue"
+	"github.com/SirClappington/enq/internal/storage"
+)
+
+type LeaseReq struct {
+	WorkerID     string   `json:"workerId"`
+	Capabilities []string `json:"capabilities"` // job types this worker handles; empty = any
+	MaxBatch     int      `json:"maxBatch"`
+	WaitSec      int      `json:"waitSec"` // long poll: wait up to this long for a job (default 1, max 30)
+}
+type LeasedJob struct {
+	ID                   string          `json:"id"`
+	Type                 string          `json:"type"`
+	Payload              json.RawMessage `json:"payload"`
+	Attempt              int             `json:"attempt"`
+	MaxAttempts          int             `json:"maxAttempts"`
+	LeaseExpiresAt       time.Time       `json:"leaseExpiresAt"`
+	LeaseVersion         int64           `json:"leaseVersion"` // fencing token; echo it on extend/complete/fail
+	VisibilityTimeoutSec int             `json:"visibilityTimeoutSec"`
+}
+type LeaseResp struct {
+	Job  *LeasedJob  `json:"job"`  // first leased job, kept for single-job clients
+	Jobs []LeasedJob `json:"jobs"` // all jobs leased by this call (up to maxBatch)
+}
+
+// maxLeaseBatch caps LeaseReq.MaxBatch so one worker can't drain a tenant.
+const maxLeaseBatch = 100
+
+const (
+	defaultLeaseWait = 1 * time.Second  // when LeaseReq.WaitSec is unset
+	maxLeaseWait     = 30 * time.Second // cap on LeaseReq.WaitSec
+	// leaseRound is the longest a lease waits on one filter; limits, caps
+	// and the tenant's types are looked up again after each round
+	leaseRound = 1 * time.Second
+	// leaseWriteSlack is added to the wait for the response's write
+	// deadline, which replaces the server's WriteTimeout for a long poll
+	leaseWriteSlack = 10 * time.Second
+)
+
+type CompleteReq struct {
+	WorkerID     string `json:"workerId"`
+	JobID        string `json:"jobId"`
+	LeaseVersion int64  `json:"leaseVersion"`
+}
+type FailReq struct {
+	WorkerID     string `json:"workerId"`
+	JobID        string `json:"jobId"`
+	LeaseVersion int64  `json:"leaseVersion"`
+	Error        string `json:"error"`
+	Retryable    bool   `json:"retryable"`
+}
+
+// lease handles POST /v1/lease.
+func (s *Server) lease(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := getTenant(req.Context())
+	if !ok {
+		writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+		return
+	}
+
+	var body LeaseReq
+	_ = json.NewDecoder(req.Body).Decode(&body)
+	if body.WorkerID == "" {
+		body.WorkerID = "dev-worker"
+	}
+
+	maxBatch := body.MaxBatch
+	if maxBatch <= 0 {
+		maxBatch = 1
+	}
+	if maxBatch > maxLeaseBatch {
+		maxBatch = maxLeaseBatch
+	}
+	wait := defaultLeaseWait
+	if body.WaitSec > 0 {
+		wait = min(time.Duration(body.WaitSec)*time.Second, maxLeaseWait)
+	}
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + leaseWriteSlack))
+
+	// a client disconnect or server shutdown ends the wait with an empty
+	// lease
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.drain:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	deadline := time.Now().Add(wait)
+	for {
+		leased, err := s.leaseRound(ctx, tenantID, body.WorkerID, body.Capabilities, maxBatch,
+			min(time.Until(deadline), leaseRound))
+		if err != nil && ctx.Err() == nil {
+			writeInternal(w, err)
+			return
+		}
+		if len(leased) > 0 || ctx.Err() != nil || time.Until(deadline) <= 0 {
+			writeLeased(w, leased)
+			return
+		}
+	}
+}
+
+// leaseRound leases up to maxBatch jobs of the given types (any when empty),
+// waiting up to block for one to become ready.
+func (s *Server) leaseRound(ctx context.Context, tenantID, workerID string, types []string, maxBatch int, block time.Duration) ([]domain.Job, error) {
+	// Rate limits and concurrency caps decide which queues may be
+	// popped from this round
+	limited, err := s.repo.RateLimitedTypes(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	limits := make(map[string]queue.RateLimit, len(limited))
+	for _, jt := range limited {
+		key := "type:" + jt.Type // no shared key: the type gets its own bucket
+		if jt.RateLimitKey != nil && *jt.RateLimitKey != "" {
+			key = "key:" + *jt.RateLimitKey
+		}
+		limits[jt.Type] = queue.RateLimit{Key: key, QPS: *jt.RateLimitQPS}
+	}
+	filter := queue.Filter{Types: types, Limits: limits}
+
+	caps, err := s.repo.ConcurrencyCaps(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if caps.Any() {
+		leasedNow, err := s.repo.LeasedCounts(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		if rem := caps.Remaining(leasedNow); rem >= 0 && rem < maxBatch {
+			maxBatch = rem
+		}
+		filter.Skip = map[string]bool{}
+		for typ := range caps.Types {
+			filter.Skip[typ] = caps.Full(leasedNow, typ)
+		}
+	}
+	if maxBatch <= 0 {
+		// at the tenant's cap: wait out the round for leases to finish
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(block):
+			return nil, nil
+		}
+	}
+
+	if s.q == nil {
+		return s.claim(ctx, tenantID, workerID, filter, caps, maxBatch, block)
+	}
+
+	// Pop up to maxBatch job ids in one round trip, only from the
+	// queues of job types this worker can handle
+	ids, err := s.q.Dequeue(ctx, tenantID, filter, block, maxBatch)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	// popped jobs must be leased or acked even if the client is gone by
+	// now; an unanswered lease simply expires
+	ctx = context.WithoutCancel(ctx)
+	leased, _, err := s.repo.Lease(ctx, tenantID, workerID, ids, caps)
+	if err != nil {
+		return nil, err
+	}
+	// popped jobs that weren't leased are done with as far as the queue is
+	// concerned: stale ones are dropped, and Lease sent the ones over a
+	// concurrency cap back through the outbox
+	got := make(map[string]bool, len(leased))
+	for _, j := range leased {
+		got[j.ID] = true
+	}
+	for _, id := range ids {
+		if !got[id] {
+			s.ack(ctx, tenantID, id)
+		}
+	}
+	return leased, nil
+}
+
+// claim is a lease round in the Postgres-only queue mode: jobs are claimed
+// straight from the store, and an empty claim waits up to block for the
+// tenant's next ready notification before trying again.
+func (s *Server) claim(ctx context.Context, tenantID, workerID string,
+	f queue.Filter, caps storage.ConcurrencyCaps, count int, block time.Duration) ([]domain.Job, error) {
+	deadline := time.Now().Add(block)
+	for {
+		// subscribe first so a job made ready during the claim isn't missed
+		ready := s.repo.Ready(tenantID)
+		leased, err := s.repo.Claim(ctx, tenantID, workerID, f, caps, count)
+		if err != nil {
+			return nil, err
+		}
+		wait := time.Until(deadline)
+		if len(leased) > 0 || wait <= 0 {
+			return leased, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ready:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// writeLeased writes the lease response for leased.
+func writeLeased(w http.ResponseWriter, leased []domain.Job) {
+	resp := LeaseResp{Jobs: make([]LeasedJob, 0, len(leased))}
+	for _, j := range leased {
+		resp.Jobs = append(resp.Jobs, LeasedJob{
+			ID: j.ID, Type: j.Type, Payload: j.Payload, Attempt: j.Attempt, MaxAttempts: j.MaxAttempts,
+			LeaseExpiresAt: *j.LeaseExpiresAt, LeaseVersion: j.LeaseVersion,
+			VisibilityTimeoutSec: j.VisibilityTimeoutSec,
+		})
+	}
+	if len(resp.Jobs) > 0 {
+		resp.Job = &resp.Jobs[0]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// extendLease handles POST /v1/lease/{id}/extend.
+func (s *Server) extendLease(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := getTenant(req.Context())
+	if !ok {
+		writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+		return
+	}
+
+	type ExtendReq struct {
+		WorkerID     string `json:"workerId"`
+		LeaseVersion int64  `json:"leaseVersion"`
+		ExtendBySec  int    `json:"extendBySec"`
+	}
+	var body ExtendReq
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	if body.ExtendBySec <= 0 {
+		body.ExtendBySec = 60
+	}
+
+	_, err := s.repo.Extend(req.Context(), tenantID, chi.URLParam(req, "id"), body.WorkerID,
+		body.LeaseVersion, time.Duration(body.ExtendBySec)*time.Second)
+	if err != nil {
+		writeAckError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// complete handles POST /v1/complete.
+func (s *Server) complete(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := getTenant(req.Context())
+	if !ok {
+		writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+		return
+	}
+
+	var body CompleteReq
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	if err := s.repo.Complete(req.Context(), tenantID, body.JobID, body.WorkerID, body.LeaseVersion); err != nil {
+		writeAckError(w, err)
+		return
+	}
+	s.ack(req.Context(), tenantID, body.JobID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fail handles POST /v1/fail.
+func (s *Server) fail(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := getTenant(req.Context())
+	if !ok {
+		writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+		return
+	}
+
+	var body FailReq
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	j, err := s.repo.Fail(req.Context(), storage.FailParams{
+		TenantID: tenantID, JobID: body.JobID, WorkerID: body.WorkerID, LeaseVersion: body.LeaseVersion,
+		Error: body.Error, Retryable: body.Retryable,
+	})
+	if err != nil {
+		writeAckError(w, err)
+		return
+	}
+	// a retry goes back to the queue through the outbox
+	s.ack(req.Context(), tenantID, j.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ack tells the queue a popped job is done with. The job's state is already
+// settled in the DB, so a failure only leaves a stale queue entry behind.
+func (s *Server) ack(ctx context.Context, tenantID, jobID string) {
+	if s.q == nil {
+		return
+	}
+	if err := s.q.Ack(ctx, tenantID, jobID); err != nil {
+		log.Printf("ack %s: %v", jobID, err)
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirClappington/enq/internal/auth"
+)
+
+func TestLeaseEmpty(t *testing.T) {
+	e := newHandlerEnv(t)
+	start := time.Now()
+	rec := e.call(e.token, "POST", "/v1/lease", LeaseReq{WorkerID: "w1", WaitSec: 1})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"job":null,"jobs":[]}` {
+		t.Errorf("body = %s", got)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("returned after %v, want a 1s wait", d)
+	}
+}
+
+func TestLeaseBatch(t *testing.T) {
+	e := newHandlerEnv(t)
+	for range 3 {
+		e.enqueue(EnqueueReq{Type: "email"})
+	}
+	var resp LeaseResp
+	if code := e.do("POST", "/v1/lease", LeaseReq{WorkerID: "w1", MaxBatch: 2}, &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(resp.Jobs) != 2 || resp.Job == nil || resp.Job.ID != resp.Jobs[0].ID {
+		t.Fatalf("response = %+v", resp)
+	}
+	for _, j := range resp.Jobs {
+		if j.Type != "email" || j.LeaseVersion != 1 || time.Until(j.LeaseExpiresAt) <= 0 {
+			t.Errorf("leased job = %+v", j)
+		}
+	}
+	if jobs := e.lease(LeaseReq{MaxBatch: 10}); len(jobs) != 1 {
+		t.Errorf("second lease got %d jobs, want the 1 left", len(jobs))
+	}
+}
+
+func TestLeaseScope(t *testing.T) {
+	e := newHandlerEnv(t)
+	readOnly, err := auth.SignHS256(auth.Claims{Tenant: e.tenant, Scope: auth.ScopeJobsRead,
+		ExpiresAt: time.Now().Add(time.Hour).Unix()}, []byte("dev-signing-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := e.call(readOnly, "POST", "/v1/lease", LeaseReq{})
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get("WWW-Authenticate"), "insufficient_scope") {
+		t.Errorf("status %d, WWW-Authenticate %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestComplete(t *testing.T) {
+	e := newHandlerEnv(t)
+	e.enqueue(EnqueueReq{Type: "email"})
+	j := e.lease(LeaseReq{})[0]
+
+	ack := func(id string, version int64) (int, string) {
+		t.Helper()
+		code, body := e.doErr("POST", "/v1/complete", CompleteReq{WorkerID: "w1", JobID: id, LeaseVersion: version})
+		return code, body.Code
+	}
+	if code, c := ack(j.ID, j.LeaseVersion+1); code != http.StatusConflict || c != codeLeaseLost {
+		t.Errorf("wrong lease version: status %d, code %q", code, c)
+	}
+	e.complete(j)
+	if code, c := ack(j.ID, j.LeaseVersion); code != http.StatusConflict || c != codeJobNotLeased {
+		t.Errorf("completed twice: status %d, code %q", code, c)
+	}
+	if code, c := ack("00000000-0000-0000-0000-000000000000", 1); code != http.StatusNotFound || c != codeJobNotFound {
+		t.Errorf("unknown job: status %d, code %q", code, c)
+	}
+	if code, body := e.doErr("POST", "/v1/complete", `{"jobId":`); code != http.StatusBadRequest || body.Code != codeBadRequest {
+		t.Errorf("malformed json: status %d, code %q", code, body.Code)
+	}
+
+	var list struct{ Jobs []struct{ ID, Status string } }
+	e.do("GET", "/v1/jobs", nil, &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].Status != "succeeded" {
+		t.Errorf("jobs = %+v", list.Jobs)
+	}
+}
+
+func TestFail(t *testing.T) {
+	tests := []struct {
+		name      string
+		retryable bool
+		status    string
+	}{
+		{"retryable", true, "failed_temp"},
+		{"permanent", false, "failed_perm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newHandlerEnv(t)
+			e.enqueue(EnqueueReq{Type: "email"})
+			j := e.lease(LeaseReq{})[0]
+			code := e.do("POST", "/v1/fail", FailReq{WorkerID: "w1", JobID: j.ID, LeaseVersion: j.LeaseVersion,
+				Error: "smtp timeout", Retryable: tt.retryable}, nil)
+			if code != http.StatusNoContent {
+				t.Fatalf("status %d", code)
+			}
+			var list struct{ Jobs []struct{ ID, Status string } }
+			e.do("GET", "/v1/jobs", nil, &list)
+			if len(list.Jobs) != 1 || list.Jobs[0].Status != tt.status {
+				t.Errorf("jobs = %+v, want %s", list.Jobs, tt.status)
+			}
+
+			// the lease is gone either way
+			code, body := e.doErr("POST", "/v1/fail", FailReq{WorkerID: "w1", JobID: j.ID, LeaseVersion: j.LeaseVersion})
+			if code != http.StatusConflict || body.Code != codeJobNotLeased {
+				t.Errorf("second fail: status %d, code %q", code, body.Code)
+			}
+		})
+	}
+}
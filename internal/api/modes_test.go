@@ -0,0 +1,405 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	r "github.com/redis/go-redis/v9"
+
+	"github.com/SirClappington/enq/internal/auth"
+	"github.com/SirClappington/enq/internal/config"
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/queue"
+	"github.com/SirClappington/enq/internal/storage"
+)
+
+const testBound = 5 * time.Minute // PRIORITY_STARVATION_BOUND_SEC
+
+// testBackend is one way of wiring a Server: a repository, and a queue in
+// front of it or none (claims straight from the repository, the
+// Postgres-only mode). fifo queues ignore priority.
+type testBackend struct {
+	repo       storage.Repository
+	q          queue.Backend
+	fifo       bool
+	db         DB
+	tenant     string
+	putJobType func(t *testing.T, jt domain.JobType)
+}
+
+type testMode struct {
+	name string
+	new  func(t *testing.T) testBackend
+}
+
+// testModes lists every queue mode the lease path must behave the same in.
+// Set ENQ_TEST_POSTGRES_DSN to a migrated database to include the Postgres
+// store.
+func testModes() []testMode {
+	modes := []testMode{
+		{"memory", func(t *testing.T) testBackend { return memoryBackend(queue.NewMemory(testBound)) }},
+		{"redis", func(t *testing.T) testBackend {
+			rdb := r.NewClient(&r.Options{Addr: miniredis.RunT(t).Addr()})
+			t.Cleanup(func() { rdb.Close() })
+			return memoryBackend(queue.New(rdb, testBound))
+		}},
+		{"streams", func(t *testing.T) testBackend {
+			rdb := r.NewClient(&r.Options{Addr: miniredis.RunT(t).Addr()})
+			t.Cleanup(func() { rdb.Close() })
+			b := memoryBackend(queue.NewStreams(rdb, "api-test"))
+			b.fifo = true
+			return b
+		}},
+		{"claim", func(t *testing.T) testBackend { return memoryBackend(nil) }},
+	}
+	if dsn := os.Getenv("ENQ_TEST_POSTGRES_DSN"); dsn != "" {
+		modes = append(modes, testMode{"claim-postgres", func(t *testing.T) testBackend { return postgresBackend(t, dsn) }})
+	}
+	return modes
+}
+
+func memoryBackend(q queue.Backend) testBackend {
+	repo := storage.NewMemory(testBound)
+	repo.AddTenant("t1", nil)
+	return testBackend{repo: repo, q: q, tenant: "t1", putJobType: func(t *testing.T, jt domain.JobType) {
+		repo.PutJobType(jt)
+	}}
+}
+
+func postgresBackend(t *testing.T, dsn string) testBackend {
+	ctx, cancel := context.WithCancel(context.Background())
+	db, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.New(db, testBound)
+	tenant := "test-" + uuid.NewString()
+	if _, err := db.Exec(ctx, `insert into tenants (id, name, api_key_hash) values ($1, $1, '')`, tenant); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); store.Listen(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		db.Exec(context.Background(), `delete from tenants where id = $1`, tenant)
+		db.Close()
+	})
+	return testBackend{repo: store, db: db, tenant: tenant, putJobType: func(t *testing.T, jt domain.JobType) {
+		_, err := db.Exec(context.Background(),
+			`insert into job_types (tenant_id, type, max_attempts, backoff_policy, visibility_timeout_sec, max_concurrency)
+			 values ($1, $2, $3, $4, $5, $6)`,
+			jt.TenantID, jt.Type, jt.MaxAttempts, jt.BackoffPolicy, jt.VisibilityTimeoutSec, jt.MaxConcurrency)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}}
+}
+
+// testEnv serves a Server on b and runs the scheduler's outbox relay and
+// MoveDue next to it, the way cmd/scheduler does.
+type testEnv struct {
+	testBackend
+	t     *testing.T
+	h     http.Handler
+	token string
+}
+
+func newTestEnv(t *testing.T, b testBackend) *testEnv {
+	t.Helper()
+	cfg := config.Config{AppEnv: "local", JWTSigningKey: "dev-signing-key", DefaultVisibilityTOSec: 60, WorkerTokenTTLSec: 900}
+	s, err := New(cfg, b.db, b.repo, b.q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.SignHS256(auth.Claims{
+		Tenant:    b.tenant,
+		Scope:     strings.Join([]string{auth.ScopeJobsRead, auth.ScopeJobsWrite, auth.ScopeLease}, " "),
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}, []byte(cfg.JWTSigningKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &testEnv{testBackend: b, t: t, h: s.Handler(), token: token}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tick := time.NewTicker(20 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				e.relay()
+			}
+		}
+	}()
+	t.Cleanup(func() { s.Drain(); cancel(); <-done })
+	return e
+}
+
+// relay runs one round of the scheduler's queue feeding.
+func (e *testEnv) relay() {
+	ctx := context.Background()
+	publish := func(domain.Job) error { return nil }
+	if e.q != nil {
+		publish = func(j domain.Job) error { return e.q.Enqueue(ctx, j.TenantID, j.Type, j.ID, j.Priority, j.RunAt) }
+	}
+	if _, err := e.repo.RelayOutbox(ctx, 1000, publish); err != nil {
+		e.t.Error("relay:", err)
+	}
+	if e.q != nil {
+		if err := e.q.MoveDue(ctx, e.tenant, time.Now(), 1000); err != nil {
+			e.t.Error("move due:", err)
+		}
+	}
+}
+
+// call sends a request with the given bearer token ("" for none).
+func (e *testEnv) call(token, method, path string, body any) *httptest.ResponseRecorder {
+	e.t.Helper()
+	var raw []byte
+	switch b := body.(type) {
+	case nil:
+	case string: // sent as is, e.g. malformed JSON
+		raw = []byte(b)
+	default:
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.h.ServeHTTP(rec, req)
+	return rec
+}
+
+// do sends a request as the test tenant and decodes a 2xx response into out.
+func (e *testEnv) do(method, path string, body, out any) int {
+	e.t.Helper()
+	rec := e.call(e.token, method, path, body)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			e.t.Fatalf("%s %s: %v in %s", method, path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+// doErr sends a request as the test tenant that should fail, and returns
+// the status and error code.
+func (e *testEnv) doErr(method, path string, body any) (int, ErrorBody) {
+	e.t.Helper()
+	rec := e.call(e.token, method, path, body)
+	var resp ErrorResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		e.t.Fatalf("%s %s: status %d, %v in %q", method, path, rec.Code, err, rec.Body)
+	}
+	return rec.Code, resp.Error
+}
+
+// enqueue enqueues a job and waits for the relay to make it leasable.
+func (e *testEnv) enqueue(body EnqueueReq) string {
+	e.t.Helper()
+	var resp struct{ ID string }
+	if code := e.do("POST", "/v1/jobs", body, &resp); code != http.StatusCreated {
+		e.t.Fatalf("enqueue: status %d", code)
+	}
+	e.relay()
+	return resp.ID
+}
+
+func (e *testEnv) lease(body LeaseReq) []LeasedJob {
+	e.t.Helper()
+	if body.WorkerID == "" {
+		body.WorkerID = "w1"
+	}
+	var resp LeaseResp
+	if code := e.do("POST", "/v1/lease", body, &resp); code != http.StatusOK {
+		e.t.Fatalf("lease: status %d", code)
+	}
+	return resp.Jobs
+}
+
+func (e *testEnv) complete(j LeasedJob) {
+	e.t.Helper()
+	if code := e.do("POST", "/v1/complete", CompleteReq{WorkerID: "w1", JobID: j.ID, LeaseVersion: j.LeaseVersion}, nil); code != http.StatusNoContent {
+		e.t.Fatalf("complete: status %d", code)
+	}
+}
+
+func jobIDs(jobs []LeasedJob) []string {
+	ids := make([]string, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	return ids
+}
+
+// TestLeaseModes checks that every queue mode leases the same jobs in the
+// same order.
+func TestLeaseModes(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, e *testEnv)
+	}{
+		{"each job once", testLeaseOnce},
+		{"priority within the starvation bound", testLeaseOrder},
+		{"capabilities", testLeaseCapabilities},
+		{"concurrency cap", testLeaseConcurrencyCap},
+		{"long poll", testLeaseLongPoll},
+		{"retry then dead letter", testLeaseRetry},
+	}
+	for _, m := range testModes() {
+		t.Run(m.name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.run(t, newTestEnv(t, m.new(t)))
+				})
+			}
+		})
+	}
+}
+
+func testLeaseOnce(t *testing.T, e *testEnv) {
+	var want []string
+	for range 3 {
+		want = append(want, e.enqueue(EnqueueReq{Type: "a"}))
+	}
+	got := jobIDs(e.lease(LeaseReq{MaxBatch: 10}))
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("leased %v, want %v", got, want)
+	}
+	if jobs := e.lease(LeaseReq{MaxBatch: 10}); len(jobs) != 0 {
+		t.Errorf("leased %v again", jobIDs(jobs))
+	}
+}
+
+func testLeaseOrder(t *testing.T, e *testEnv) {
+	if e.fifo {
+		t.Skip("the queue ignores priority")
+	}
+	now := time.Now().UTC()
+	at := func(d time.Duration) *time.Time { t := now.Add(d); return &t }
+	prio := func(p int) *int { return &p }
+	// scores (run_at less priority/1000 of the 5m bound): -10m, -5m, -2.5m, -1m
+	old := e.enqueue(EnqueueReq{Type: "a", Priority: prio(0), RunAt: at(-10 * time.Minute)})
+	recent := e.enqueue(EnqueueReq{Type: "a", Priority: prio(0), RunAt: at(-time.Minute)})
+	urgent := e.enqueue(EnqueueReq{Type: "b", Priority: prio(1000), RunAt: at(0)})
+	mid := e.enqueue(EnqueueReq{Type: "b", Priority: prio(500), RunAt: at(0)})
+
+	var got []string
+	for range 4 {
+		got = append(got, jobIDs(e.lease(LeaseReq{}))...)
+	}
+	if want := []string{old, urgent, mid, recent}; !slices.Equal(got, want) {
+		t.Errorf("lease order = %v, want %v", got, want)
+	}
+}
+
+func testLeaseCapabilities(t *testing.T, e *testEnv) {
+	e.enqueue(EnqueueReq{Type: "a"})
+	b := e.enqueue(EnqueueReq{Type: "b"})
+	if got := jobIDs(e.lease(LeaseReq{Capabilities: []string{"b"}, MaxBatch: 10})); !slices.Equal(got, []string{b}) {
+		t.Errorf("leased %v, want only %v", got, b)
+	}
+}
+
+func testLeaseConcurrencyCap(t *testing.T, e *testEnv) {
+	one := 1
+	e.putJobType(t, domain.JobType{TenantID: e.tenant, Type: "capped", MaxAttempts: 10,
+		BackoffPolicy: "exponential", VisibilityTimeoutSec: 60, MaxConcurrency: &one})
+	e.enqueue(EnqueueReq{Type: "capped"})
+	e.enqueue(EnqueueReq{Type: "capped"})
+
+	first := e.lease(LeaseReq{MaxBatch: 2})
+	if len(first) != 1 {
+		t.Fatalf("leased %d jobs over a cap of 1", len(first))
+	}
+	if jobs := e.lease(LeaseReq{}); len(jobs) != 0 {
+		t.Fatalf("leased %v at the cap", jobIDs(jobs))
+	}
+	e.complete(first[0])
+	second := e.lease(LeaseReq{WaitSec: 5})
+	if len(second) != 1 || second[0].ID == first[0].ID {
+		t.Errorf("after completing %s leased %v", first[0].ID, jobIDs(second))
+	}
+}
+
+func testLeaseLongPoll(t *testing.T, e *testEnv) {
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		e.do("POST", "/v1/jobs", EnqueueReq{Type: "a"}, nil)
+	}()
+	start := time.Now()
+	jobs := e.lease(LeaseReq{WaitSec: 10})
+	if len(jobs) != 1 {
+		t.Fatalf("leased %d jobs", len(jobs))
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("lease returned %v after the enqueue", d)
+	}
+}
+
+func testLeaseRetry(t *testing.T, e *testEnv) {
+	policy, attempts := "fixed:1s", 2
+	id := e.enqueue(EnqueueReq{Type: "a", BackoffPolicy: &policy, MaxAttempts: &attempts})
+	for attempt := range attempts { // counted from 0
+		jobs := e.lease(LeaseReq{WaitSec: 5})
+		if len(jobs) != 1 || jobs[0].ID != id || jobs[0].Attempt != attempt {
+			t.Fatalf("attempt %d: leased %+v", attempt, jobs)
+		}
+		code := e.do("POST", "/v1/fail", FailReq{WorkerID: "w1", JobID: id, LeaseVersion: jobs[0].LeaseVersion,
+			Error: "boom", Retryable: true}, nil)
+		if code != http.StatusNoContent {
+			t.Fatalf("fail: status %d", code)
+		}
+	}
+	var list struct {
+		Jobs []struct{ ID, Status string }
+	}
+	e.do("GET", "/v1/jobs", nil, &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].Status != string(domain.DeadLettered) {
+		t.Errorf("jobs = %+v, want %s dead lettered", list.Jobs, id)
+	}
+	if e.db == nil {
+		return // the DLQ routes need Postgres
+	}
+	admin, err := auth.SignHS256(auth.Claims{Tenant: e.tenant, Scope: auth.ScopeAdmin,
+		ExpiresAt: time.Now().Add(time.Hour).Unix()}, []byte("dev-signing-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := e.call(admin, "DELETE", "/v1/dlq/"+id, nil); rec.Code != http.StatusOK {
+		t.Errorf("purge: status %d", rec.Code)
+	}
+	var resp ErrorResp
+	rec := e.call(admin, "DELETE", "/v1/dlq/"+id, nil)
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusNotFound || resp.Error.Code != codeDeadLetterNotFound {
+		t.Errorf("purge again: status %d, code %q", rec.Code, resp.Error.Code)
+	}
+}
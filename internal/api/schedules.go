@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/SirClappington/enq/internal/cron"
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/retry"
+)
+
+type ScheduleReq struct {
+	Type        string                     `json:"type"`
+	Cron        *string                    `json:"cron"`        // 5/6-field cron expression, or
+	IntervalSec *int                       `json:"intervalSec"` // a fixed interval
+	Timezone    string                     `json:"timezone"`    // IANA zone for cron; default UTC
+	Payload     json.RawMessage            `json:"payload"`
+	Enabled     *bool                      `json:"enabled"`
+	Job         *domain.ScheduleJobOptions `json:"job"` // options for the enqueued jobs
+}
+
+type Schedule struct {
+	ID          string                     `json:"id"`
+	Type        string                     `json:"type"`
+	Cron        *string                    `json:"cron"`
+	IntervalSec *int                       `json:"intervalSec"`
+	Timezone    string                     `json:"timezone"`
+	Payload     json.RawMessage            `json:"payload"`
+	Enabled     bool                       `json:"enabled"`
+	Job         *domain.ScheduleJobOptions `json:"job"`
+	NextRunAt   time.Time                  `json:"nextRunAt"`
+	LastRunAt   *time.Time                 `json:"lastRunAt"`
+}
+
+const scheduleCols = `id::text, type, cron_expr, interval_sec, timezone,
+coalesce(payload, '{}'::jsonb), enabled, config, next_run_at, last_run_at`
+
+func scanSchedule(row pgx.Row) (Schedule, error) {
+	var s Schedule
+	var cfg []byte
+	err := row.Scan(&s.ID, &s.Type, &s.Cron, &s.IntervalSec, &s.Timezone,
+		&s.Payload, &s.Enabled, &cfg, &s.NextRunAt, &s.LastRunAt)
+	if err == nil && len(cfg) > 0 {
+		s.Job = &domain.ScheduleJobOptions{}
+		err = json.Unmarshal(cfg, s.Job)
+	}
+	return s, err
+}
+
+// validate checks the request and returns the first activation time.
+func (b *ScheduleReq) validate() (time.Time, error) {
+	if b.Type == "" {
+		return time.Time{}, errors.New("type is required")
+	}
+	if b.Timezone == "" {
+		b.Timezone = "UTC"
+	}
+	if len(b.Payload) == 0 {
+		b.Payload = json.RawMessage(`{}`)
+	}
+	if b.Job != nil && b.Job.BackoffPolicy != nil {
+		if _, err := retry.Parse(*b.Job.BackoffPolicy); err != nil {
+			return time.Time{}, errors.New("invalid job.backoffPolicy: " + err.Error())
+		}
+	}
+	spec, err := cron.FromSpec(b.Cron, b.IntervalSec, b.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := spec.Next(time.Now().UTC())
+	if next.IsZero() {
+		return time.Time{}, errors.New("schedule never fires")
+	}
+	return next, nil
+}
+
+// mountSchedules registers tenant-scoped CRUD for recurring jobs; the
+// scheduler process fires them.
+//
+//	POST   /v1/schedules
+//	GET    /v1/schedules
+//	GET    /v1/schedules/{id}
+//	PUT    /v1/schedules/{id}   full replace; next run is recomputed
+//	DELETE /v1/schedules/{id}
+func mountSchedules(r chi.Router, db DB) {
+	r.Post("/v1/schedules", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		var body ScheduleReq
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		next, err := body.validate()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		enabled := body.Enabled == nil || *body.Enabled
+
+		s, err := scanSchedule(db.QueryRow(req.Context(),
+			`insert into schedules(id, tenant_id, type, cron_expr, interval_sec, timezone, next_run_at, enabled, payload, config)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			 returning `+scheduleCols,
+			uuid.NewString(), tenantID, body.Type, body.Cron, body.IntervalSec, body.Timezone,
+			next, enabled, body.Payload, body.Job))
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(s)
+	})
+
+	r.Get("/v1/schedules", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		rows, err := db.Query(req.Context(),
+			`select `+scheduleCols+` from schedules where tenant_id = $1 order by created_at`, tenantID)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		defer rows.Close()
+
+		out := []Schedule{}
+		for rows.Next() {
+			s, err := scanSchedule(rows)
+			if err != nil {
+				writeInternal(w, err)
+				return
+			}
+			out = append(out, s)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"schedules": out})
+	})
+
+	r.Get("/v1/schedules/{id}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		s, err := scanSchedule(db.QueryRow(req.Context(),
+			`select `+scheduleCols+` from schedules where id::text = $1 and tenant_id = $2`,
+			chi.URLParam(req, "id"), tenantID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeScheduleNotFound, "schedule not found")
+			return
+		}
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s)
+	})
+
+	r.Put("/v1/schedules/{id}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		var body ScheduleReq
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		next, err := body.validate()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		enabled := body.Enabled == nil || *body.Enabled
+
+		s, err := scanSchedule(db.QueryRow(req.Context(),
+			`update schedules
+			    set type = $3, cron_expr = $4, interval_sec = $5, timezone = $6,
+			        next_run_at = $7, enabled = $8, payload = $9, config = $10, updated_at = now()
+			  where id::text = $1 and tenant_id = $2
+			  returning `+scheduleCols,
+			chi.URLParam(req, "id"), tenantID, body.Type, body.Cron, body.IntervalSec, body.Timezone,
+			next, enabled, body.Payload, body.Job))
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeScheduleNotFound, "schedule not found")
+			return
+		}
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s)
+	})
+
+	r.Delete("/v1/schedules/{id}", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+
+		tag, err := db.Exec(req.Context(),
+			`delete from schedules where id::text = $1 and tenant_id = $2`,
+			chi.URLParam(req, "id"), tenantID)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeError(w, http.StatusNotFound, codeScheduleNotFound, "schedule not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/SirClappington/enq/internal/jsonschema"
+)
+
+// schemaCache holds compiled job type schemas per tenant and type, so
+// enqueue doesn't compile one per request. An entry is only used while the
+// stored schema is the one it was compiled from, which picks up writes made
+// through other replicas; writes through this one drop it at once.
+type schemaCache struct {
+	mu sync.Mutex
+	m  map[string]cachedSchema
+}
+
+type cachedSchema struct {
+	raw []byte
+	sch *jsonschema.Schema
+}
+
+func newSchemaCache() *schemaCache { return &schemaCache{m: map[string]cachedSchema{}} }
+
+func schemaKey(tenantID, typ string) string { return tenantID + "\x00" + typ }
+
+// get returns raw, the stored schema of the tenant's type, compiled.
+func (c *schemaCache) get(tenantID, typ string, raw []byte) (*jsonschema.Schema, error) {
+	key := schemaKey(tenantID, typ)
+	c.mu.Lock()
+	e, ok := c.m[key]
+	c.mu.Unlock()
+	if ok && bytes.Equal(e.raw, raw) {
+		return e.sch, nil
+	}
+
+	sch, err := jsonschema.Compile(raw)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.m[key] = cachedSchema{raw: bytes.Clone(raw), sch: sch}
+	c.mu.Unlock()
+	return sch, nil
+}
+
+// forget drops the tenant's type; call it whenever the type is written.
+func (c *schemaCache) forget(tenantID, typ string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.m, schemaKey(tenantID, typ))
+}
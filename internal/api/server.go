@@ -0,0 +1,123 @@
+// Package api implements enq's HTTP API. Build a Server from its storage and
+// queue dependencies and serve Server.Handler, standalone (cmd/api) or
+// mounted inside another service.
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/SirClappington/enq/internal/auth"
+	"github.com/SirClappington/enq/internal/config"
+	"github.com/SirClappington/enq/internal/queue"
+	"github.com/SirClappington/enq/internal/storage"
+)
+
+// DB is the Postgres access the handlers need; *pgxpool.Pool satisfies it.
+type DB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type Server struct {
+	cfg    config.Config
+	db     DB // admin routes and API keys; nil serves jobs and leases only
+	repo   storage.Repository
+	q      queue.Backend // nil: Postgres-only mode, leases claim from jobs
+	secret []byte        // HS256 key for worker tokens; nil disables HS256
+	jwts   *auth.Verifier
+
+	schemas *schemaCache // compiled job type schemas
+
+	drain     chan struct{} // closed by Drain to end long-poll leases
+	drainOnce sync.Once
+}
+
+// New builds a Server. db may be nil to run on an in-memory repo: only the
+// job and lease routes are served then, authenticated by JWT or, with
+// APP_ENV=local, the dev key. The dev JWT signing key is refused unless
+// APP_ENV=local is set. q may be nil to claim jobs straight from repo
+// (QUEUE_BACKEND=postgres). It fails if the configured JWKS file can't be
+// loaded.
+func New(cfg config.Config, db DB, repo storage.Repository, q queue.Backend) (*Server, error) {
+	secret := []byte(cfg.JWTSigningKey)
+	if !cfg.Local() && cfg.JWTSigningKey == "dev-signing-key" {
+		log.Printf("JWT_SIGNING_KEY is the dev default; HS256 tokens are disabled")
+		secret = nil
+	}
+	jwts, err := auth.NewVerifier(secret, cfg.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	jwts.Issuer, jwts.Audience = cfg.JWTIssuer, cfg.JWTAudience
+	return &Server{cfg: cfg, db: db, repo: repo, q: q, secret: secret, jwts: jwts,
+		schemas: newSchemaCache(), drain: make(chan struct{})}, nil
+}
+
+// Drain makes waiting leases return now, empty, instead of holding up a
+// graceful shutdown. Register it with http.Server.RegisterOnShutdown.
+func (s *Server) Drain() { s.drainOnce.Do(func() { close(s.drain) }) }
+
+// Handler returns the API's routes. /health is public; everything under
+// /v1 requires an API key or JWT with the route's scope.
+func (s *Server) Handler() http.Handler {
+	rtr := chi.NewRouter()
+	rtr.Use(requestID)
+	rtr.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, codeNotFound, "no such route")
+	})
+	rtr.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
+	})
+
+	rtr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	rtr.Group(func(protected chi.Router) {
+		protected.Use(s.authenticate)
+
+		protected.With(requireScope(auth.ScopeJobsWrite)).Post("/v1/jobs", s.enqueue)
+		protected.With(requireScope(auth.ScopeJobsRead)).Get("/v1/jobs", s.listJobs)
+		protected.With(requireScope(auth.ScopeJobsRead)).Get("/v1/jobs/{id}/events", s.jobEvents)
+
+		protected.With(requireScope(auth.ScopeLease)).Post("/v1/lease", s.lease)
+		protected.With(requireScope(auth.ScopeLease)).Post("/v1/lease/{id}/extend", s.extendLease)
+		protected.With(requireScope(auth.ScopeLease)).Post("/v1/complete", s.complete)
+		protected.With(requireScope(auth.ScopeLease)).Post("/v1/fail", s.fail)
+
+		mountTokens(protected, s.secret, s.jwts, time.Duration(s.cfg.WorkerTokenTTLSec)*time.Second)
+		if s.db != nil {
+			admin := protected.With(requireScope(auth.ScopeAdmin))
+			mountDLQ(admin, s.db)
+			mountKeys(admin, s.db)
+			mountSchedules(protected.With(requireScope(auth.ScopeSchedules)), s.db)
+			mountJobTypes(admin, s.db, s.cfg, s.schemas)
+		}
+	})
+
+	rtr.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	})
+	return rtr
+}
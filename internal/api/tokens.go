@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SirClappington/enq/internal/auth"
+)
+
+type TokenReq struct {
+	Scopes []string `json:"scopes"` // subset of the key's scopes, except admin; default ["lease"]
+	TTLSec int      `json:"ttlSec"` // capped at WORKER_TOKEN_TTL_SEC
+}
+
+type TokenResp struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// mountTokens registers the exchange of an API key for a short-lived HS256
+// JWT, so workers don't need to hold long-lived keys. Tokens can't be used to
+// mint further tokens, and can't carry admin: an admin could mint a
+// permanent API key and outlive the token.
+//
+//	POST /v1/auth/token
+func mountTokens(r chi.Router, secret []byte, v *auth.Verifier, maxTTL time.Duration) {
+	r.Post("/v1/auth/token", func(w http.ResponseWriter, req *http.Request) {
+		tenantID, ok := getTenant(req.Context())
+		if !ok {
+			writeUnauthorized(w, "Unauthorized", "Unauthorized Tenant")
+			return
+		}
+		keyID, ok := getAPIKeyID(req.Context())
+		if !ok {
+			writeUnauthorized(w, "invalid_token", "tokens must be minted with an API key")
+			return
+		}
+		if len(secret) == 0 {
+			writeError(w, http.StatusServiceUnavailable, codeUnavailable, "token minting is disabled")
+			return
+		}
+
+		var body TokenReq
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if len(body.Scopes) == 0 {
+			body.Scopes = []string{auth.ScopeLease}
+		}
+		if err := auth.ValidateScopes(body.Scopes); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		granted, _ := req.Context().Value(scopesKey).([]string)
+		for _, s := range body.Scopes {
+			if s == auth.ScopeAdmin {
+				writeError(w, http.StatusBadRequest, codeBadRequest, "tokens can't carry the admin scope")
+				return
+			}
+			if !auth.HasScope(granted, s) {
+				writeUnauthorized(w, "insufficient_scope", "key lacks scope "+s)
+				return
+			}
+		}
+		ttl := maxTTL
+		if body.TTLSec > 0 && time.Duration(body.TTLSec)*time.Second < ttl {
+			ttl = time.Duration(body.TTLSec) * time.Second
+		}
+
+		now := time.Now()
+		exp := now.Add(ttl)
+		// the issuer and audience the API expects, so the token verifies
+		var aud auth.Audience
+		if v.Audience != "" {
+			aud = auth.Audience{v.Audience}
+		}
+		token, err := auth.SignHS256(auth.Claims{
+			Issuer:    v.Issuer,
+			Audience:  aud,
+			Subject:   "key:" + keyID,
+			Tenant:    tenantID,
+			Scope:     strings.Join(body.Scopes, " "),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: exp.Unix(),
+		}, secret)
+		if err != nil {
+			writeInternal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(TokenResp{Token: token, TokenType: "Bearer", Scopes: body.Scopes, ExpiresAt: exp.UTC().Truncate(time.Second)})
+	})
+}
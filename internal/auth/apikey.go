@@ -0,0 +1,53 @@
+// Package auth holds credential helpers for the API.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// API keys look like enq_<8 hex>_<64 hex>. The first PrefixLen characters
+// are stored in clear so a key can be found by prefix; only the SHA-256 of
+// the whole key is kept. Keys carry 256 bits of randomness, so a fast hash
+// is enough.
+const (
+	keyTag    = "enq_"
+	PrefixLen = len(keyTag) + 8
+)
+
+// NewAPIKey mints a key and returns it with its lookup prefix and hash.
+// The key itself must be shown to the caller once and never stored.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	var pub [4]byte
+	var secret [32]byte
+	if _, err = rand.Read(pub[:]); err != nil {
+		return "", "", "", err
+	}
+	if _, err = rand.Read(secret[:]); err != nil {
+		return "", "", "", err
+	}
+	key = keyTag + hex.EncodeToString(pub[:]) + "_" + hex.EncodeToString(secret[:])
+	return key, KeyPrefix(key), HashKey(key), nil
+}
+
+// KeyPrefix returns the public lookup prefix of a key. Keys that predate
+// the enq_ format are handled the same way.
+func KeyPrefix(key string) string {
+	if len(key) < PrefixLen {
+		return key
+	}
+	return key[:PrefixLen]
+}
+
+// HashKey returns the hex SHA-256 of key, as stored in api_keys.key_hash.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyMatches compares key against a stored hash in constant time.
+func KeyMatches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashKey(key)), []byte(hash)) == 1
+}
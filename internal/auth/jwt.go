@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Claims are the JWT claims the API understands. Tenant and Scope are
+// required; Scope is a space-separated list as in RFC 8693.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Tenant    string   `json:"tenant"`
+	Scope     string   `json:"scope"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// Scopes splits the scope claim.
+func (c *Claims) Scopes() []string { return strings.Fields(c.Scope) }
+
+// Audience is the aud claim, which RFC 7519 allows as a single string or
+// an array of them.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = Audience{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// clockSkew is tolerated on exp and nbf.
+const clockSkew = 30 * time.Second
+
+var b64 = base64.RawURLEncoding
+
+// LooksLikeJWT tells a compact JWS apart from an API key.
+func LooksLikeJWT(token string) bool { return strings.Count(token, ".") == 2 }
+
+// Verifier checks HS256 tokens against a shared secret and RS256/EdDSA tokens
+// against public keys from a JWKS file. Either source may be absent.
+type Verifier struct {
+	// Issuer and Audience, if set, are required of every token: iss must
+	// equal Issuer and aud must include Audience.
+	Issuer, Audience string
+
+	secret []byte
+	keys   map[string]crypto.PublicKey // by kid
+}
+
+// NewVerifier builds a Verifier. An empty secret disables HS256 and an empty
+// jwksPath disables RS256/EdDSA.
+func NewVerifier(secret []byte, jwksPath string) (*Verifier, error) {
+	v := &Verifier{secret: secret, keys: map[string]crypto.PublicKey{}}
+	if jwksPath == "" {
+		return v, nil
+	}
+	raw, err := os.ReadFile(jwksPath)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	for _, k := range set.Keys {
+		switch {
+		case k.Kty == "RSA":
+			n, err1 := b64.DecodeString(k.N)
+			e, err2 := b64.DecodeString(k.E)
+			if err := errors.Join(err1, err2); err != nil {
+				return nil, fmt.Errorf("jwks: key %q: %w", k.Kid, err)
+			}
+			v.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			x, err := b64.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("jwks: key %q: bad Ed25519 key", k.Kid)
+			}
+			v.keys[k.Kid] = ed25519.PublicKey(x)
+		default:
+			return nil, fmt.Errorf("jwks: key %q: unsupported kty %q", k.Kid, k.Kty)
+		}
+	}
+	return v, nil
+}
+
+// Verify checks the signature, time claims and, if v expects them, the
+// issuer and audience of token and returns its claims.
+func (v *Verifier) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jwt: malformed token")
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, err
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("jwt: malformed signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch hdr.Alg {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return nil, errors.New("jwt: HS256 is not enabled")
+		}
+		if !hmac.Equal(sig, hmacSHA256(v.secret, signed)) {
+			return nil, errors.New("jwt: bad signature")
+		}
+	case "RS256":
+		k, ok := v.keys[hdr.Kid].(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt: unknown RSA key %q", hdr.Kid)
+		}
+		sum := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) != nil {
+			return nil, errors.New("jwt: bad signature")
+		}
+	case "EdDSA":
+		k, ok := v.keys[hdr.Kid].(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt: unknown Ed25519 key %q", hdr.Kid)
+		}
+		if !ed25519.Verify(k, signed, sig) {
+			return nil, errors.New("jwt: bad signature")
+		}
+	default:
+		return nil, fmt.Errorf("jwt: unsupported alg %q", hdr.Alg)
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, err
+	}
+	switch {
+	case c.ExpiresAt == 0:
+		return nil, errors.New("jwt: exp is required")
+	case now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)):
+		return nil, errors.New("jwt: token expired")
+	case c.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(c.NotBefore, 0)):
+		return nil, errors.New("jwt: token not yet valid")
+	case c.Tenant == "":
+		return nil, errors.New("jwt: tenant claim is required")
+	case v.Issuer != "" && c.Issuer != v.Issuer:
+		return nil, fmt.Errorf("jwt: unexpected issuer %q", c.Issuer)
+	case v.Audience != "" && !slices.Contains(c.Audience, v.Audience):
+		return nil, fmt.Errorf("jwt: token is not for audience %q", v.Audience)
+	}
+	return &c, nil
+}
+
+// SignHS256 issues a token for c signed with secret.
+func SignHS256(c Claims, secret []byte) (string, error) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	s := b64.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + b64.EncodeToString(body)
+	return s + "." + b64.EncodeToString(hmacSHA256(secret, []byte(s))), nil
+}
+
+func hmacSHA256(key, msg []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(msg)
+	return m.Sum(nil)
+}
+
+func decodeSegment(seg string, v any) error {
+	raw, err := b64.DecodeString(seg)
+	if err != nil {
+		return errors.New("jwt: malformed segment")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("jwt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("test-secret")
+	testNow    = time.Unix(1_700_000_000, 0)
+)
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ed  ed25519.PrivateKey
+	v   *Verifier
+}
+
+// newTestKeys builds a Verifier with testSecret and a JWKS holding an RSA
+// key "rsa-1" and an Ed25519 key "ed-1".
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	epub, epriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "n": b64.EncodeToString(rk.N.Bytes()),
+			"e": b64.EncodeToString(big.NewInt(int64(rk.E)).Bytes())},
+		{"kty": "OKP", "crv": "Ed25519", "kid": "ed-1", "x": b64.EncodeToString(epub)},
+	}}
+	v, err := NewVerifier(testSecret, writeJWKS(t, jwks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKeys{rsa: rk, ed: epriv, v: v}
+}
+
+func writeJWKS(t *testing.T, jwks any) string {
+	t.Helper()
+	raw, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sign builds a token with the given header, signed the way alg says.
+func (k *testKeys) sign(t *testing.T, alg, kid string, c Claims) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(c)
+	s := b64.EncodeToString(hdr) + "." + b64.EncodeToString(body)
+	var sig []byte
+	switch alg {
+	case "HS256":
+		sig = hmacSHA256(testSecret, []byte(s))
+	case "RS256":
+		sum := sha256.Sum256([]byte(s))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "EdDSA":
+		sig = ed25519.Sign(k.ed, []byte(s))
+	}
+	return s + "." + b64.EncodeToString(sig)
+}
+
+func validClaims() Claims {
+	return Claims{Tenant: "t1", Scope: "lease jobs:read", ExpiresAt: testNow.Add(time.Minute).Unix()}
+}
+
+func TestVerify(t *testing.T) {
+	k := newTestKeys(t)
+	for _, alg := range []struct{ alg, kid string }{{"HS256", ""}, {"RS256", "rsa-1"}, {"EdDSA", "ed-1"}} {
+		t.Run(alg.alg, func(t *testing.T) {
+			c, err := k.v.Verify(k.sign(t, alg.alg, alg.kid, validClaims()), testNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Tenant != "t1" || strings.Join(c.Scopes(), ",") != "lease,jobs:read" {
+				t.Errorf("claims = %+v", c)
+			}
+		})
+	}
+
+	// SignHS256 is what POST /v1/auth/token issues
+	tok, err := SignHS256(validClaims(), testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.v.Verify(tok, testNow); err != nil {
+		t.Errorf("SignHS256 token: %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	k := newTestKeys(t)
+	claims := func(f func(*Claims)) Claims {
+		c := validClaims()
+		f(&c)
+		return c
+	}
+	tampered := func(tok string) string {
+		parts := strings.Split(tok, ".")
+		body, _ := json.Marshal(claims(func(c *Claims) { c.Tenant = "t2" }))
+		return parts[0] + "." + b64.EncodeToString(body) + "." + parts[2]
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"malformed", "a.b", "malformed token"},
+		{"bad header", "!!." + strings.SplitN(k.sign(t, "HS256", "", validClaims()), ".", 2)[1], "malformed segment"},
+		{"alg none", k.sign(t, "none", "", validClaims()), `unsupported alg "none"`},
+
+		// alg and kid must agree with the key they name
+		{"unknown kid", k.sign(t, "RS256", "rsa-2", validClaims()), `unknown RSA key "rsa-2"`},
+		{"RS256 with Ed25519 kid", k.sign(t, "RS256", "ed-1", validClaims()), `unknown RSA key "ed-1"`},
+		{"EdDSA with RSA kid", k.sign(t, "EdDSA", "rsa-1", validClaims()), `unknown Ed25519 key "rsa-1"`},
+
+		// bad signatures
+		{"HS256 tampered", tampered(k.sign(t, "HS256", "", validClaims())), "bad signature"},
+		{"RS256 tampered", tampered(k.sign(t, "RS256", "rsa-1", validClaims())), "bad signature"},
+		{"EdDSA tampered", tampered(k.sign(t, "EdDSA", "ed-1", validClaims())), "bad signature"},
+		{"HS256 wrong secret", mustSign(t, validClaims(), []byte("other")), "bad signature"},
+
+		// time claims, with clockSkew either way
+		{"no exp", k.sign(t, "HS256", "", claims(func(c *Claims) { c.ExpiresAt = 0 })), "exp is required"},
+		{"expired", k.sign(t, "HS256", "", claims(func(c *Claims) {
+			c.ExpiresAt = testNow.Add(-clockSkew - time.Second).Unix()
+		})), "token expired"},
+		{"not yet valid", k.sign(t, "HS256", "", claims(func(c *Claims) {
+			c.NotBefore = testNow.Add(clockSkew + time.Second).Unix()
+		})), "not yet valid"},
+
+		{"no tenant", k.sign(t, "HS256", "", claims(func(c *Claims) { c.Tenant = "" })), "tenant claim is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := k.v.Verify(tt.token, testNow)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyClockSkew(t *testing.T) {
+	k := newTestKeys(t)
+	c := validClaims()
+	c.ExpiresAt = testNow.Add(-clockSkew + time.Second).Unix()
+	c.NotBefore = testNow.Add(clockSkew - time.Second).Unix()
+	if _, err := k.v.Verify(k.sign(t, "HS256", "", c), testNow); err != nil {
+		t.Errorf("token within clock skew: %v", err)
+	}
+}
+
+func TestVerifyIssuerAudience(t *testing.T) {
+	k := newTestKeys(t)
+	k.v.Issuer, k.v.Audience = "https://idp.example", "enq"
+	claims := func(iss string, aud ...string) Claims {
+		c := validClaims()
+		c.Issuer, c.Audience = iss, aud
+		return c
+	}
+
+	tests := []struct {
+		name string
+		c    Claims
+		want string // "" for accepted
+	}{
+		{"match", claims("https://idp.example", "enq"), ""},
+		{"one of several audiences", claims("https://idp.example", "other", "enq"), ""},
+		{"no iss", claims("", "enq"), `unexpected issuer ""`},
+		{"wrong iss", claims("https://evil.example", "enq"), `unexpected issuer "https://evil.example"`},
+		{"no aud", claims("https://idp.example"), `not for audience "enq"`},
+		{"wrong aud", claims("https://idp.example", "billing"), `not for audience "enq"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := k.v.Verify(k.sign(t, "RS256", "rsa-1", tt.c), testNow)
+			if tt.want == "" && err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("Verify error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// aud may be a string or an array of them.
+func TestAudienceJSON(t *testing.T) {
+	for _, tt := range []struct {
+		raw  string
+		want Audience
+	}{
+		{`"enq"`, Audience{"enq"}},
+		{`["enq","other"]`, Audience{"enq", "other"}},
+	} {
+		var a Audience
+		if err := json.Unmarshal([]byte(tt.raw), &a); err != nil || !slices.Equal(a, tt.want) {
+			t.Errorf("Unmarshal(%s) = %q, %v", tt.raw, a, err)
+		}
+		if raw, _ := json.Marshal(a); string(raw) != tt.raw {
+			t.Errorf("Marshal(%q) = %s, want %s", a, raw, tt.raw)
+		}
+	}
+	if err := json.Unmarshal([]byte(`42`), new(Audience)); err == nil {
+		t.Error("Unmarshal(42) succeeded")
+	}
+}
+
+func TestVerifyHS256Disabled(t *testing.T) {
+	v, err := NewVerifier(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Verify(mustSign(t, validClaims(), testSecret), testNow)
+	if err == nil || !strings.Contains(err.Error(), "HS256 is not enabled") {
+		t.Errorf("Verify error = %v", err)
+	}
+}
+
+func TestNewVerifierErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		jwks any
+		want string
+	}{
+		{"not json", "{", "jwks:"},
+		{"unsupported kty", map[string]any{"keys": []map[string]string{{"kty": "EC", "kid": "k"}}}, `unsupported kty "EC"`},
+		{"bad Ed25519 key", map[string]any{"keys": []map[string]string{{"kty": "OKP", "crv": "Ed25519", "kid": "k", "x": "AAAA"}}},
+			"bad Ed25519 key"},
+		{"bad RSA modulus", map[string]any{"keys": []map[string]string{{"kty": "RSA", "kid": "k", "n": "!", "e": "AQAB"}}},
+			`key "k"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+			if s, ok := tt.jwks.(string); ok {
+				os.WriteFile(path, []byte(s), 0o600)
+			} else {
+				path = writeJWKS(t, tt.jwks)
+			}
+			_, err := NewVerifier(testSecret, path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewVerifier error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewVerifier(testSecret, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("NewVerifier with a missing file succeeded")
+	}
+}
+
+func mustSign(t *testing.T, c Claims, secret []byte) string {
+	t.Helper()
+	tok, err := SignHS256(c, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
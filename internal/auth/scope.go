@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Scopes a credential can carry. ScopeAdmin implies every other scope.
+const (
+	ScopeJobsWrite = "jobs:write" // enqueue
+	ScopeJobsRead  = "jobs:read"  // list jobs and their events
+	ScopeLease     = "lease"      // lease, extend, complete, fail
+	ScopeSchedules = "schedules"  // manage recurring jobs
+	ScopeAdmin     = "admin"      // keys, job types, DLQ
+)
+
+// AllScopes lists every known scope.
+var AllScopes = []string{ScopeJobsWrite, ScopeJobsRead, ScopeLease, ScopeSchedules, ScopeAdmin}
+
+// ValidateScopes rejects empty or unknown scope lists.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, s := range scopes {
+		known := false
+		for _, k := range AllScopes {
+			known = known || s == k
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether granted allows want.
+func HasScope(granted []string, want string) bool {
+	for _, s := range granted {
+		if s == want || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
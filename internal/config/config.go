@@ -7,16 +7,28 @@ import (
 )
 
 type Config struct {
-	AppEnv                 string `env:"APP_ENV" envDefault:"local"`
+	AppEnv                 string `env:"APP_ENV" envDefault:"production"`
 	APIAddr                string `env:"API_ADDR" envDefault:":8080"`
 	SchedAddr              string `env:"SCHED_ADDR" envDefault:":8081"`
-	PostgresDSN            string `env:"POSTGRES_DSN,notEmpty"`
-	RedisAddr              string `env:"REDIS_ADDR,notEmpty"`
+	Storage                string `env:"STORAGE" envDefault:"postgres"` // postgres | memory (nothing persisted)
+	PostgresDSN            string `env:"POSTGRES_DSN"`                  // required unless STORAGE=memory
+	RedisAddr              string `env:"REDIS_ADDR"`                    // required unless QUEUE_BACKEND=postgres
 	RedisPassword          string `env:"REDIS_PASSWORD"`
 	JWTSigningKey          string `env:"JWT_SIGNING_KEY" envDefault:"dev-signing-key"`
+	JWKSFile               string `env:"JWT_JWKS_FILE"`
+	JWTIssuer              string `env:"JWT_ISSUER"`   // if set, tokens must carry this iss
+	JWTAudience            string `env:"JWT_AUDIENCE"` // if set, tokens' aud must include it
+	WorkerTokenTTLSec      int    `env:"WORKER_TOKEN_TTL_SEC" envDefault:"900"`
 	DefaultVisibilityTOSec int    `env:"DEFAULT_VISIBILITY_TIMEOUT_SEC" envDefault:"60"`
+	StarvationBoundSec     int    `env:"PRIORITY_STARVATION_BOUND_SEC" envDefault:"300"`
+	QueueBackend           string `env:"QUEUE_BACKEND" envDefault:"redis"` // redis | streams | postgres
 }
 
+// Local reports whether local development mode was explicitly enabled with
+// APP_ENV=local. It turns on the dev API key and the dev JWT signing key, so
+// it must never be the default.
+func (c Config) Local() bool { return c.AppEnv == "local" }
+
 func Load() Config {
 	var c Config
 	if err := env.Parse(&c); err != nil {
@@ -0,0 +1,192 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s: %v", name, err)
+	}
+	return loc
+}
+
+// nexts returns the first n activations of expr after from.
+func nexts(t *testing.T, expr string, loc *time.Location, from time.Time, n int) []time.Time {
+	t.Helper()
+	s, err := Parse(expr, loc)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expr, err)
+	}
+	var out []time.Time
+	for range n {
+		from = s.Next(from)
+		out = append(out, from)
+	}
+	return out
+}
+
+func checkNexts(t *testing.T, expr string, loc *time.Location, from time.Time, want ...time.Time) {
+	t.Helper()
+	got := nexts(t, expr, loc, from, len(want))
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("%q after %v: activation %d = %v, want %v", expr, from, i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestNextFields(t *testing.T) {
+	at := func(h, m, s int) time.Time { return time.Date(2025, 6, 2, h, m, s, 0, time.UTC) } // a Monday
+	tests := []struct {
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		// 5 fields fire on the minute
+		{"*/15 * * * *", at(10, 7, 30), []time.Time{at(10, 15, 0), at(10, 30, 0)}},
+		{"0 9-17/4 * * *", at(10, 0, 0), []time.Time{at(13, 0, 0), at(17, 0, 0)}},
+		// 6 fields lead with seconds
+		{"30 */15 * * * *", at(10, 15, 30), []time.Time{at(10, 30, 30), at(10, 45, 30)}},
+		{"*/20 * * * * *", at(10, 0, 0), []time.Time{at(10, 0, 20), at(10, 0, 40), at(10, 1, 0)}},
+		// strictly after: a time that matches is skipped
+		{"0 12 * * *", at(12, 0, 0), []time.Time{at(12, 0, 0).AddDate(0, 0, 1)}},
+		{"0 12 * * mon-fri", at(12, 0, 0).AddDate(0, 0, 4), []time.Time{at(12, 0, 0).AddDate(0, 0, 7)}},
+		{"@hourly", at(10, 59, 59), []time.Time{at(11, 0, 0)}},
+		{"@daily", at(10, 0, 0), []time.Time{at(0, 0, 0).AddDate(0, 0, 1)}},
+		{"0 0 1 jan *", at(0, 0, 0), []time.Time{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		checkNexts(t, tt.expr, time.UTC, tt.from, tt.want...)
+	}
+}
+
+// When both day fields are restricted a day matches if either does; a *
+// in one of them leaves only the other.
+func TestNextDayOfMonthOrWeek(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 0, 0, 0, 0, time.UTC) }
+	from := day(time.July, 1)
+	// the 13th or a Friday (2025-07-13 is a Sunday)
+	checkNexts(t, "0 0 13 * fri", time.UTC, from,
+		day(time.July, 4), day(time.July, 11), day(time.July, 13), day(time.July, 18))
+	checkNexts(t, "0 0 13 * *", time.UTC, from, day(time.July, 13), day(time.August, 13))
+	checkNexts(t, "0 0 * * 5", time.UTC, from, day(time.July, 4), day(time.July, 11))
+	checkNexts(t, "0 0 ? * 7", time.UTC, from, day(time.July, 6)) // 7 is Sunday too
+}
+
+func TestNextTimeZone(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	from := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	want := time.Date(2025, 1, 10, 14, 0, 0, 0, time.UTC) // 09:00 EST
+
+	checkNexts(t, "0 9 * * *", ny, from, want)
+	// CRON_TZ= overrides the location Parse is given
+	checkNexts(t, "CRON_TZ=America/New_York 0 9 * * *", time.UTC, from, want)
+	checkNexts(t, "TZ=America/New_York 0 9 * * *", mustLoad(t, "Asia/Tokyo"), from, want)
+
+	s, err := Parse("CRON_TZ=America/New_York @daily", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Location().String() != ny.String() {
+		t.Errorf("Location() = %v", s.Location())
+	}
+	// Next answers in the location of its argument
+	if got := s.Next(from); got.Location() != time.UTC {
+		t.Errorf("Next returned a time in %v", got.Location())
+	}
+}
+
+// Across DST changes, wall-clock times that don't exist are skipped and
+// ones that happen twice fire twice.
+func TestNextDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	utc := func(mo time.Month, d, h, m int) time.Time { return time.Date(2025, mo, d, h, m, 0, 0, time.UTC) }
+
+	// 2025-03-09 02:00 EST jumps to 03:00 EDT
+	checkNexts(t, "30 2 * * *", ny, time.Date(2025, 3, 8, 3, 0, 0, 0, ny),
+		utc(time.March, 10, 6, 30), utc(time.March, 11, 6, 30))
+	checkNexts(t, "0 * * * *", ny, time.Date(2025, 3, 9, 1, 30, 0, 0, ny),
+		utc(time.March, 9, 7, 0), utc(time.March, 9, 8, 0)) // 03:00 and 04:00 EDT
+
+	// 2025-11-02 02:00 EDT falls back to 01:00 EST
+	checkNexts(t, "30 1 * * *", ny, time.Date(2025, 11, 2, 0, 0, 0, 0, ny),
+		utc(time.November, 2, 5, 30), utc(time.November, 2, 6, 30), utc(time.November, 3, 6, 30))
+	checkNexts(t, "0 0 * * *", ny, time.Date(2025, 11, 1, 12, 0, 0, 0, ny),
+		utc(time.November, 2, 4, 0), utc(time.November, 3, 5, 0))
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next of Feb 30 = %v, want the zero time", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct{ expr, want string }{
+		{"* * * *", "expected 5 or 6 fields"},
+		{"* * * * * * *", "expected 5 or 6 fields"},
+		{"60 * * * *", "outside 0-59"},
+		{"* 24 * * *", "outside 0-23"},
+		{"* * 0 * *", "outside 1-31"},
+		{"* * * 13 *", "outside 1-12"},
+		{"5-1 * * * *", "range 5-1"},
+		{"*/0 * * * *", "bad step"},
+		{"* * * foo *", `bad value "foo"`},
+		{"CRON_TZ=Nowhere/Special * * * * *", "bad time zone"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.expr, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want one containing %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestEvery(t *testing.T) {
+	from := time.Date(2025, 6, 2, 10, 0, 0, 300_000_000, time.UTC)
+	if got, want := Every(1500*time.Millisecond).Next(from), from.Truncate(time.Second).Add(time.Second); !got.Equal(want) {
+		t.Errorf("Every(1.5s).Next = %v, want %v", got, want)
+	}
+	if got := Every(0); got.Delay != time.Second {
+		t.Errorf("Every(0) = %v, want 1s", got.Delay)
+	}
+}
+
+func TestFromSpec(t *testing.T) {
+	expr, sec, zero := "0 9 * * *", 90, 0
+	s, err := FromSpec(&expr, nil, "America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sch, ok := s.(*Schedule); !ok || sch.Location().String() != "America/New_York" {
+		t.Errorf("FromSpec(expr) = %#v", s)
+	}
+	if s, err := FromSpec(nil, &sec, ""); err != nil || s != Every(90*time.Second) {
+		t.Errorf("FromSpec(interval) = %v, %v", s, err)
+	}
+
+	for _, tt := range []struct {
+		expr *string
+		sec  *int
+		tz   string
+		want string
+	}{
+		{&expr, &sec, "", "not both"},
+		{nil, nil, "", "is required"},
+		{nil, &zero, "", "must be positive"},
+		{&expr, nil, "Nowhere/Special", "bad time zone"},
+	} {
+		if _, err := FromSpec(tt.expr, tt.sec, tt.tz); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("FromSpec error = %v, want one containing %q", err, tt.want)
+		}
+	}
+}
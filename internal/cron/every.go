@@ -0,0 +1,54 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Nexter is anything that can compute its next activation.
+type Nexter interface {
+	Next(t time.Time) time.Time
+}
+
+// ConstantDelay fires every Delay, aligned to whole seconds. Adapted from
+// robfig/cron v3's ConstantDelaySchedule (MIT); see NOTICE.
+type ConstantDelay struct{ Delay time.Duration }
+
+// Every returns a ConstantDelay schedule. The delay is truncated to whole
+// seconds, with a minimum of one second.
+func Every(d time.Duration) ConstantDelay {
+	if d < time.Second {
+		d = time.Second
+	}
+	return ConstantDelay{d.Truncate(time.Second)}
+}
+
+func (c ConstantDelay) Next(t time.Time) time.Time {
+	return t.Add(c.Delay - time.Duration(t.Nanosecond()))
+}
+
+// FromSpec builds the schedule for a schedules row: a cron expression
+// evaluated in tz, or an interval in seconds. Exactly one must be set.
+func FromSpec(expr *string, intervalSec *int, tz string) (Nexter, error) {
+	switch {
+	case expr != nil && intervalSec != nil:
+		return nil, errors.New("cron: set either a cron expression or an interval, not both")
+	case expr != nil:
+		loc := time.UTC
+		if tz != "" {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return nil, fmt.Errorf("cron: bad time zone %q: %w", tz, err)
+			}
+		}
+		return Parse(*expr, loc)
+	case intervalSec != nil:
+		if *intervalSec <= 0 {
+			return nil, errors.New("cron: interval must be positive")
+		}
+		return Every(time.Duration(*intervalSec) * time.Second), nil
+	default:
+		return nil, errors.New("cron: a cron expression or an interval is required")
+	}
+}
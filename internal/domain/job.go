@@ -29,7 +29,55 @@ type Job struct {
 	Status               Status
 	LeasedBy             *string
 	LeaseExpiresAt       *time.Time
+	LeaseVersion         int64
 	Error                *string
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 }
+
+// JobType holds a tenant's per-type defaults and payload contract.
+type JobType struct {
+	ID                   int64
+	TenantID             string
+	Type                 string
+	MaxAttempts          int
+	BackoffPolicy        string
+	VisibilityTimeoutSec int
+	RateLimitKey         *string
+	RateLimitQPS         *int
+	MaxConcurrency       *int
+	Schema               []byte // JSON Schema for payloads; nil = any
+}
+
+// Event is a job lifecycle transition recorded in job_events.
+type Event string
+
+const (
+	EventEnqueued     Event = "enqueued"
+	EventLeased       Event = "leased"
+	EventExtended     Event = "extended"
+	EventCompleted    Event = "completed"
+	EventFailed       Event = "failed"
+	EventRetried      Event = "retried"
+	EventLeaseExpired Event = "lease_expired"
+	EventDeadLettered Event = "dead_lettered"
+	EventReplayed     Event = "replayed"
+)
+
+type JobEvent struct {
+	ID        int64
+	JobID     string
+	TenantID  string
+	Event     Event
+	Metadata  []byte
+	CreatedAt time.Time
+}
+
+// ScheduleJobOptions is stored in schedules.config and applied to every job
+// a schedule enqueues. Unset fields fall back to the enqueue defaults.
+type ScheduleJobOptions struct {
+	Priority             *int    `json:"priority,omitempty"`
+	MaxAttempts          *int    `json:"maxAttempts,omitempty"`
+	BackoffPolicy        *string `json:"backoffPolicy,omitempty"`
+	VisibilityTimeoutSec *int    `json:"visibilityTimeoutSec,omitempty"`
+}
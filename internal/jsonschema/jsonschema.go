@@ -0,0 +1,549 @@
+// Package jsonschema validates JSON documents against the subset of JSON
+// Schema (draft 7 / 2020-12) that job payload contracts need:
+//
+//	type, enum, const,
+//	properties, required, additionalProperties, minProperties, maxProperties,
+//	items, minItems, maxItems, uniqueItems,
+//	minLength, maxLength, pattern,
+//	minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf,
+//	allOf, anyOf, oneOf, not, and local $ref ("#/definitions/x", "#/$defs/x").
+//
+// Compile rejects any other keyword (format, patternProperties, if/then/else,
+// ...) instead of ignoring it as the spec would, so a schema never looks
+// stricter than what is enforced. Annotations such as title, description
+// and default are allowed, as are extensions prefixed "x-".
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation is one reason a document failed validation. Path is a JSON
+// pointer to the offending value ("" for the root).
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// Schema is a compiled schema, safe for concurrent use.
+type Schema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+// keywords are the keywords Compile accepts: the ones validate enforces,
+// the ones it uses to find subschemas, and annotations.
+var keywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true, "minProperties": true, "maxProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	"minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true, "multipleOf": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+	"$ref": true, "definitions": true, "$defs": true,
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// Compile parses a schema document and checks the keywords it relies on.
+func Compile(raw []byte) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("jsonschema: %w", err)
+	}
+	s := &Schema{root: root, patterns: map[string]*regexp.Regexp{}}
+	if err := s.check(root, "", map[uintptr]int{}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// check walks every subschema. loops is the checkLoops state shared by the
+// whole walk.
+func (s *Schema) check(node any, path string, loops map[uintptr]int) error {
+	switch n := node.(type) {
+	case bool:
+		return nil
+	case map[string]any:
+		if err := s.checkLoops(n, path, loops); err != nil {
+			return err
+		}
+		if p, ok := n["pattern"]; ok {
+			ps, ok := p.(string)
+			if !ok {
+				return fmt.Errorf("jsonschema: %s/pattern must be a string", path)
+			}
+			re, err := regexp.Compile(ps)
+			if err != nil {
+				return fmt.Errorf("jsonschema: %s/pattern: %w", path, err)
+			}
+			s.patterns[ps] = re
+		}
+		if ref, ok := n["$ref"].(string); ok {
+			if _, err := s.resolve(ref); err != nil {
+				return err
+			}
+		}
+		for k, v := range n {
+			if !keywords[k] && !strings.HasPrefix(k, "x-") {
+				return fmt.Errorf("jsonschema: %s/%s: keyword is not supported", path, k)
+			}
+			switch k {
+			case "properties", "definitions", "$defs":
+				m, ok := v.(map[string]any)
+				if !ok {
+					return fmt.Errorf("jsonschema: %s/%s must be an object", path, k)
+				}
+				for name, sub := range m {
+					if err := s.check(sub, path+"/"+k+"/"+name, loops); err != nil {
+						return err
+					}
+				}
+			case "allOf", "anyOf", "oneOf":
+				arr, ok := v.([]any)
+				if !ok {
+					return fmt.Errorf("jsonschema: %s/%s must be an array", path, k)
+				}
+				for i, sub := range arr {
+					if err := s.check(sub, path+"/"+k+"/"+strconv.Itoa(i), loops); err != nil {
+						return err
+					}
+				}
+			case "items", "additionalProperties", "not":
+				if err := s.check(v, path+"/"+k, loops); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("jsonschema: schema at %q must be an object or boolean", path)
+	}
+}
+
+// checkLoops rejects a schema that reaches itself again without moving to
+// a child value: through $ref, allOf, anyOf, oneOf or not it would be
+// applied to the same value forever. Recursion through properties or items
+// is fine, as the document bounds it. loops marks nodes in progress (1) and
+// known to be loop free (2).
+func (s *Schema) checkLoops(node any, path string, loops map[uintptr]int) error {
+	n, ok := node.(map[string]any)
+	if !ok {
+		return nil
+	}
+	id := reflect.ValueOf(n).Pointer()
+	switch loops[id] {
+	case 1:
+		return fmt.Errorf("jsonschema: schema at %q refers back to itself without descending into the document", path)
+	case 2:
+		return nil
+	}
+	loops[id] = 1
+	if ref, ok := n["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			return err
+		}
+		if err := s.checkLoops(target, path+"/$ref", loops); err != nil {
+			return err
+		}
+	}
+	for _, k := range []string{"allOf", "anyOf", "oneOf"} {
+		arr, _ := n[k].([]any)
+		for i, sub := range arr {
+			if err := s.checkLoops(sub, path+"/"+k+"/"+strconv.Itoa(i), loops); err != nil {
+				return err
+			}
+		}
+	}
+	if not, ok := n["not"]; ok {
+		if err := s.checkLoops(not, path+"/not", loops); err != nil {
+			return err
+		}
+	}
+	loops[id] = 2
+	return nil
+}
+
+func (s *Schema) resolve(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("jsonschema: only local $ref is supported, got %q", ref)
+	}
+	node := s.root
+	ptr := strings.TrimPrefix(ref, "#")
+	if ptr == "" {
+		return node, nil
+	}
+	for _, tok := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("jsonschema: unresolvable $ref %q", ref)
+		}
+		if node, ok = m[tok]; !ok {
+			return nil, fmt.Errorf("jsonschema: unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// Validate checks doc against the schema. The error is non-nil only when
+// doc is not valid JSON.
+func (s *Schema) Validate(doc []byte) ([]Violation, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("jsonschema: trailing data after document")
+	}
+	var out []Violation
+	r := &run{Schema: s, budget: maxSteps}
+	r.validate(s.root, v, "", &out, 0)
+	if r.budget < 0 {
+		// whatever was found so far is incomplete; the document is rejected
+		out = append(out, Violation{Message: "schema is too expensive to evaluate against this document"})
+	}
+	return out, nil
+}
+
+const (
+	// maxDepth stops deeply nested documents from recursing too far.
+	maxDepth = 64
+	// maxSteps caps the subschema applications one Validate may make, so a
+	// schema whose branches multiply with document depth can't pin a CPU.
+	maxSteps = 100_000
+)
+
+// run is the state of one Validate call.
+type run struct {
+	*Schema
+	budget int // subschema applications left; negative once exhausted
+}
+
+func (s *run) validate(node, v any, path string, out *[]Violation, depth int) {
+	add := func(format string, args ...any) {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.budget--; s.budget < 0 {
+		return
+	}
+	if depth > maxDepth {
+		add("schema nesting too deep")
+		return
+	}
+
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			add("no value is allowed here")
+		}
+		return
+	case map[string]any:
+		if ref, ok := n["$ref"].(string); ok {
+			target, err := s.resolve(ref)
+			if err != nil {
+				add("%v", err)
+				return
+			}
+			s.validate(target, v, path, out, depth+1)
+		}
+
+		if t, ok := n["type"]; ok && !matchesType(t, v) {
+			add("expected %s, got %s", typeNames(t), typeOf(v))
+			return
+		}
+		if enum, ok := n["enum"].([]any); ok {
+			found := false
+			for _, e := range enum {
+				if equal(e, v) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				add("must be one of %s", compact(enum))
+			}
+		}
+		if c, ok := n["const"]; ok && !equal(c, v) {
+			add("must equal %s", compact(c))
+		}
+
+		switch val := v.(type) {
+		case map[string]any:
+			s.validateObject(n, val, path, out, depth)
+		case []any:
+			s.validateArray(n, val, path, out, depth)
+		case string:
+			l := float64(utf8.RuneCountInString(val))
+			if m, ok := num(n["minLength"]); ok && l < m {
+				add("must be at least %v characters", m)
+			}
+			if m, ok := num(n["maxLength"]); ok && l > m {
+				add("must be at most %v characters", m)
+			}
+			if p, ok := n["pattern"].(string); ok {
+				// patterns only reachable through an odd $ref weren't compiled up front
+				re := s.patterns[p]
+				if re == nil {
+					re, _ = regexp.Compile(p)
+				}
+				if re != nil && !re.MatchString(val) {
+					add("must match pattern %q", p)
+				}
+			}
+		case json.Number:
+			f, _ := val.Float64()
+			if m, ok := num(n["minimum"]); ok && f < m {
+				add("must be >= %v", m)
+			}
+			if m, ok := num(n["maximum"]); ok && f > m {
+				add("must be <= %v", m)
+			}
+			if m, ok := num(n["exclusiveMinimum"]); ok && f <= m {
+				add("must be > %v", m)
+			}
+			if m, ok := num(n["exclusiveMaximum"]); ok && f >= m {
+				add("must be < %v", m)
+			}
+			if m, ok := num(n["multipleOf"]); ok && m > 0 {
+				if q := f / m; math.Abs(q-math.Round(q)) > 1e-9 {
+					add("must be a multiple of %v", m)
+				}
+			}
+		}
+
+		if all, ok := n["allOf"].([]any); ok {
+			for _, sub := range all {
+				s.validate(sub, v, path, out, depth+1)
+			}
+		}
+		if anyOf, ok := n["anyOf"].([]any); ok {
+			if s.countMatches(anyOf, v, path, depth) == 0 {
+				add("must match at least one schema in anyOf")
+			}
+		}
+		if oneOf, ok := n["oneOf"].([]any); ok {
+			if c := s.countMatches(oneOf, v, path, depth); c != 1 {
+				add("must match exactly one schema in oneOf (matched %d)", c)
+			}
+		}
+		if not, ok := n["not"]; ok {
+			var sub []Violation
+			s.validate(not, v, path, &sub, depth+1)
+			if len(sub) == 0 {
+				add("must not match the schema in not")
+			}
+		}
+	}
+}
+
+func (s *run) countMatches(schemas []any, v any, path string, depth int) int {
+	c := 0
+	for _, sub := range schemas {
+		var tmp []Violation
+		s.validate(sub, v, path, &tmp, depth+1)
+		if len(tmp) == 0 {
+			c++
+		}
+	}
+	return c
+}
+
+func (s *run) validateObject(n map[string]any, obj map[string]any, path string, out *[]Violation, depth int) {
+	if req, ok := n["required"].([]any); ok {
+		for _, r := range req {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					*out = append(*out, Violation{Path: path + "/" + escape(name), Message: "is required"})
+				}
+			}
+		}
+	}
+	if m, ok := num(n["minProperties"]); ok && float64(len(obj)) < m {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf("must have at least %v properties", m)})
+	}
+	if m, ok := num(n["maxProperties"]); ok && float64(len(obj)) > m {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf("must have at most %v properties", m)})
+	}
+
+	props, _ := n["properties"].(map[string]any)
+	addl, hasAddl := n["additionalProperties"]
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // stable violation order
+	for _, k := range keys {
+		child := path + "/" + escape(k)
+		if sub, ok := props[k]; ok {
+			s.validate(sub, obj[k], child, out, depth+1)
+		} else if hasAddl {
+			if b, ok := addl.(bool); ok && !b {
+				*out = append(*out, Violation{Path: child, Message: "additional property is not allowed"})
+			} else {
+				s.validate(addl, obj[k], child, out, depth+1)
+			}
+		}
+	}
+}
+
+func (s *run) validateArray(n map[string]any, arr []any, path string, out *[]Violation, depth int) {
+	if m, ok := num(n["minItems"]); ok && float64(len(arr)) < m {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf("must have at least %v items", m)})
+	}
+	if m, ok := num(n["maxItems"]); ok && float64(len(arr)) > m {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf("must have at most %v items", m)})
+	}
+	if u, ok := n["uniqueItems"].(bool); ok && u {
+		// each item is encoded once, so this is charged one step per item
+		if s.budget -= len(arr); s.budget < 0 {
+			return
+		}
+		seen := make(map[string]int, len(arr))
+		for i, it := range arr {
+			key := canonical(it)
+			if j, dup := seen[key]; dup {
+				*out = append(*out, Violation{Path: path, Message: fmt.Sprintf("items %d and %d are equal", j, i)})
+				break
+			}
+			seen[key] = i
+		}
+	}
+	if items, ok := n["items"]; ok {
+		for i, it := range arr {
+			s.validate(items, it, path+"/"+strconv.Itoa(i), out, depth+1)
+		}
+	}
+}
+
+func matchesType(t, v any) bool {
+	switch tt := t.(type) {
+	case string:
+		return isType(tt, v)
+	case []any:
+		for _, x := range tt {
+			if name, ok := x.(string); ok && isType(name, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, v any) bool {
+	switch name {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	default:
+		return typeOf(v) == name
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeNames(t any) string {
+	if arr, ok := t.([]any); ok {
+		parts := make([]string, 0, len(arr))
+		for _, x := range arr {
+			parts = append(parts, fmt.Sprint(x))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// equal compares a schema value (float64 numbers) with a document value
+// (json.Number) by normalizing both through float64.
+func equal(a, b any) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// canonical encodes a document value so that exactly the values equal
+// reports as equal encode the same: numbers go through float64 and object
+// keys are sorted.
+func canonical(v any) string {
+	b, _ := json.Marshal(normalize(v))
+	return string(b)
+}
+
+func normalize(v any) any {
+	switch x := v.(type) {
+	case json.Number:
+		f, _ := x.Float64()
+		if f == 0 {
+			return 0.0 // and not -0, which equals it
+		}
+		return f
+	case []any:
+		out := make([]any, len(x))
+		for i := range x {
+			out[i] = normalize(x[i])
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k := range x {
+			out[k] = normalize(x[k])
+		}
+		return out
+	}
+	return v
+}
+
+func num(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func compact(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func escape(tok string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(tok, "~", "~0"), "/", "~1")
+}
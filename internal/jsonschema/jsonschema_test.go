@@ -0,0 +1,179 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		want   []string // violations as "path: message", in order
+	}{
+		{"type ok", `{"type":"object"}`, `{}`, nil},
+		{"type mismatch", `{"type":"string"}`, `1`, []string{"expected string, got number"}},
+		{"type list", `{"type":["string","null"]}`, `null`, nil},
+		{"integer", `{"type":"integer"}`, `1.5`, []string{"expected integer, got number"}},
+		{"integer whole float", `{"type":"integer"}`, `2.0`, nil},
+		{"enum", `{"enum":["a","b"]}`, `"c"`, []string{`must be one of ["a","b"]`}},
+		{"enum number", `{"enum":[1,2]}`, `2`, nil},
+		{"const", `{"const":{"a":1}}`, `{"a":1}`, nil},
+		{"required", `{"required":["a","b"]}`, `{"a":1}`, []string{"/b: is required"}},
+		{"nested property", `{"properties":{"a":{"properties":{"b":{"type":"string"}}}}}`, `{"a":{"b":1}}`,
+			[]string{"/a/b: expected string, got number"}},
+		{"additionalProperties false", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`,
+			[]string{"/b: additional property is not allowed"}},
+		{"additionalProperties schema", `{"additionalProperties":{"type":"number"}}`, `{"x":"y"}`,
+			[]string{"/x: expected number, got string"}},
+		{"min/maxProperties", `{"minProperties":2}`, `{"a":1}`, []string{"must have at least 2 properties"}},
+		{"items", `{"items":{"type":"number"}}`, `[1,"a"]`, []string{"/1: expected number, got string"}},
+		{"min/maxItems", `{"maxItems":1}`, `[1,2]`, []string{"must have at most 1 items"}},
+		{"uniqueItems", `{"uniqueItems":true}`, `[1,2,1]`, []string{"items 0 and 2 are equal"}},
+		{"uniqueItems once per array", `{"uniqueItems":true}`, `[1,1,1,1]`, []string{"items 0 and 1 are equal"}},
+		{"uniqueItems deep", `{"uniqueItems":true}`, `[{"a":[1.0,{"b":0}]},{"a":[1,{"b":-0}]}]`,
+			[]string{"items 0 and 1 are equal"}},
+		{"uniqueItems distinct", `{"uniqueItems":true}`, `[1,"1",[1],{"1":1},true,null]`, nil},
+		{"string length", `{"minLength":2,"maxLength":3}`, `"é"`, []string{"must be at least 2 characters"}},
+		{"pattern", `{"pattern":"^a+$"}`, `"ab"`, []string{`must match pattern "^a+$"`}},
+		{"numeric bounds", `{"minimum":1,"exclusiveMaximum":3}`, `3`, []string{"must be < 3"}},
+		{"multipleOf", `{"multipleOf":0.5}`, `1.25`, []string{"must be a multiple of 0.5"}},
+		{"allOf", `{"allOf":[{"type":"number"},{"minimum":5}]}`, `3`, []string{"must be >= 5"}},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"type":"null"}]}`, `1`,
+			[]string{"must match at least one schema in anyOf"}},
+		{"oneOf", `{"oneOf":[{"type":"number"},{"minimum":0}]}`, `1`,
+			[]string{"must match exactly one schema in oneOf (matched 2)"}},
+		{"not", `{"not":{"type":"null"}}`, `null`, []string{"must not match the schema in not"}},
+		{"false schema", `{"properties":{"a":false}}`, `{"a":1}`, []string{"/a: no value is allowed here"}},
+		{"ref to definitions", `{"definitions":{"id":{"type":"string"}},"properties":{"id":{"$ref":"#/definitions/id"}}}`,
+			`{"id":7}`, []string{"/id: expected string, got number"}},
+		{"ref to $defs", `{"$defs":{"n":{"minimum":1}},"$ref":"#/$defs/n"}`, `0`, []string{"must be >= 1"}},
+		{"escaped pointer", `{"properties":{"a/b":{"type":"string"}}}`, `{"a/b":1}`,
+			[]string{"/a~1b: expected string, got number"}},
+		{"recursive through items", `{"properties":{"kids":{"items":{"$ref":"#"}}},"required":["name"]}`,
+			`{"name":"a","kids":[{"name":"b"},{"kids":[]}]}`, []string{"/kids/1/name: is required"}},
+		{"annotations", `{"$schema":"https://json-schema.org/draft/2020-12/schema","title":"t","description":"d",
+			"default":1,"examples":[1],"x-note":1}`, `"any"`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Compile([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			vs, err := s.Validate([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			var got []string
+			for _, v := range vs {
+				got = append(got, v.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("violations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBadDocument(t *testing.T) {
+	s, err := Compile([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []string{``, `{`, `{} {}`} {
+		if _, err := s.Validate([]byte(doc)); err == nil {
+			t.Errorf("Validate(%q) succeeded, want an error", doc)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name, schema, want string
+	}{
+		{"not json", `{`, "unexpected end"},
+		{"not a schema", `[1]`, "must be an object or boolean"},
+		{"bad pattern", `{"pattern":"("}`, "pattern"},
+		{"pattern not a string", `{"pattern":1}`, "must be a string"},
+		{"properties not an object", `{"properties":[]}`, "must be an object"},
+		{"allOf not an array", `{"allOf":{}}`, "must be an array"},
+		{"remote ref", `{"$ref":"http://example.com/s.json"}`, "only local $ref"},
+		{"dangling ref", `{"$ref":"#/definitions/nope"}`, "unresolvable $ref"},
+		{"self ref", `{"$ref":"#"}`, "refers back to itself"},
+		{"self ref through allOf", `{"$ref":"#","allOf":[{"$ref":"#"},{"$ref":"#"}]}`, "refers back to itself"},
+		{"ref cycle", `{"definitions":{"a":{"$ref":"#/definitions/b"},"b":{"anyOf":[{"$ref":"#/definitions/a"}]}}}`,
+			"refers back to itself"},
+		{"ref cycle through not", `{"properties":{"x":{"not":{"$ref":"#/properties/x"}}}}`, "refers back to itself"},
+		{"format", `{"format":"email"}`, "/format: keyword is not supported"},
+		{"if/then/else", `{"if":{"type":"string"},"then":{"minLength":1}}`, "keyword is not supported"},
+		{"nested unsupported keyword", `{"properties":{"a":{"patternProperties":{"^x":{}}}}}`,
+			"/properties/a/patternProperties: keyword is not supported"},
+		{"unsupported under items", `{"items":{"prefixItems":[{}]}}`, "/items/prefixItems: keyword is not supported"},
+		{"dependentRequired", `{"dependentRequired":{"a":["b"]}}`, "keyword is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Compile error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// A schema whose branches double at every level of the document must be
+// cut off by the step budget instead of running for 2^depth steps.
+func TestValidateBudget(t *testing.T) {
+	s, err := Compile([]byte(`{
+		"definitions": {
+			"t": {"allOf": [{"$ref": "#/definitions/n"}, {"$ref": "#/definitions/n"}]},
+			"n": {"properties": {"c": {"$ref": "#/definitions/t"}}}
+		},
+		"$ref": "#/definitions/t"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := strings.Repeat(`{"c":`, 40) + `{}` + strings.Repeat(`}`, 40)
+
+	start := time.Now()
+	vs, err := s.Validate([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Validate took %v", d)
+	}
+	if len(vs) == 0 || !strings.Contains(vs[len(vs)-1].Message, "too expensive") {
+		t.Errorf("violations = %v, want the budget violation last", vs)
+	}
+}
+
+// uniqueItems over a large array is charged to the budget and reports one
+// violation, not one per equal pair.
+func TestValidateUniqueItemsBudget(t *testing.T) {
+	s, err := Compile([]byte(`{"uniqueItems":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := func(n int) []byte { return []byte("[" + strings.Repeat(`{"a":[1,2]},`, n-1) + `{"a":[1,2]}]`) }
+
+	start := time.Now()
+	vs, err := s.Validate(doc(50_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 || vs[0].Message != "items 0 and 1 are equal" {
+		t.Errorf("violations = %v", vs)
+	}
+	vs, _ = s.Validate(doc(maxSteps + 1))
+	if len(vs) != 1 || !strings.Contains(vs[0].Message, "too expensive") {
+		t.Errorf("violations = %v, want only the budget violation", vs)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Validate took %v", d)
+	}
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	r "github.com/redis/go-redis/v9"
+)
+
+// Backend is the ready queue between Postgres and the workers. Postgres stays
+// the source of truth: a backend only hands out job IDs, and whoever pops one
+// still has to lease it in the DB.
+//
+// RedisQ (sorted sets) is the default, Streams adds consumer-group pending
+// tracking, and Memory runs in process for tests.
+type Backend interface {
+	// Enqueue makes jobID ready at runAt, or holds it in a delay set until
+	// MoveDue promotes it. It is idempotent: a job is held at most once,
+	// however often it is enqueued.
+	Enqueue(ctx context.Context, tenant, typ, jobID string, priority int, runAt time.Time) error
+	// Dequeue pops up to count ready job IDs from the types allowed by f,
+	// blocking up to block for the first one. It returns an empty slice when
+	// nothing is ready.
+	Dequeue(ctx context.Context, tenant string, f Filter, block time.Duration, count int) ([]string, error)
+	// MoveDue promotes up to batch delayed jobs per type that are due at now.
+	MoveDue(ctx context.Context, tenant string, now time.Time, batch int) error
+	// Ack tells the backend a popped job is done with: it was leased and
+	// then completed or failed, or it turned out not to be leasable. Backends
+	// that forget a job when it is popped treat it as a no-op.
+	Ack(ctx context.Context, tenant, jobID string) error
+	// Missing returns the IDs of jobs that are neither ready nor delayed in
+	// the backend, so reconcile can push back only what was lost.
+	Missing(ctx context.Context, tenant string, jobs []Ref) ([]string, error)
+}
+
+// Ref names a job the way the backend holds it.
+type Ref struct {
+	ID       string
+	Type     string
+	Priority int
+}
+
+var (
+	_ Backend = (*RedisQ)(nil)
+	_ Backend = (*Streams)(nil)
+	_ Backend = (*Memory)(nil)
+)
+
+// Filter narrows what a dequeue may pop.
+type Filter struct {
+	Types  []string             // only these types; all known types when empty
+	Skip   map[string]bool      // types to leave alone this round, e.g. at a concurrency cap
+	Limits map[string]RateLimit // per-type lease rate limits
+}
+
+// NewBackend builds the Redis-backed Backend named by kind (QUEUE_BACKEND):
+// "redis" for RedisQ or "streams" for Streams reading as consumer. The
+// "postgres" mode has no Backend; callers claim from storage instead.
+func NewBackend(kind string, rdb *r.Client, starvationBound time.Duration, consumer string) (Backend, error) {
+	switch kind {
+	case "", "redis":
+		return New(rdb, starvationBound), nil
+	case "streams":
+		return NewStreams(rdb, consumer), nil
+	}
+	return nil, fmt.Errorf("unknown queue backend %q", kind)
+}
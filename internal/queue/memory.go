@@ -0,0 +1,195 @@
+package queue
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process Backend for tests and local demos. It orders jobs
+// like RedisQ (by ReadyScore) and applies the same rate limits, but only
+// serves the process it lives in.
+type Memory struct {
+	mu              sync.Mutex
+	starvationBound time.Duration
+	ready           map[string]map[string]float64 // tenant:type -> job -> score
+	delay           map[string]map[string]delayed // tenant:type -> job -> due
+	types           map[string]map[string]bool    // tenant -> types
+	buckets         map[string]*bucket
+	wake            chan struct{} // closed and replaced whenever a job becomes ready
+}
+
+type delayed struct {
+	at       time.Time
+	priority int
+}
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+func NewMemory(starvationBound time.Duration) *Memory {
+	return &Memory{
+		starvationBound: starvationBound,
+		ready:           map[string]map[string]float64{},
+		delay:           map[string]map[string]delayed{},
+		types:           map[string]map[string]bool{},
+		buckets:         map[string]*bucket{},
+		wake:            make(chan struct{}),
+	}
+}
+
+// Enqueue puts jobID in exactly one of its type's ready and delay sets, so a
+// rescheduled job is never held twice.
+func (q *Memory) Enqueue(ctx context.Context, tenant, typ, jobID string, priority int, runAt time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.types[tenant] == nil {
+		q.types[tenant] = map[string]bool{}
+	}
+	q.types[tenant][typ] = true
+	key := tenant + ":" + typ
+	if time.Until(runAt) > 0 {
+		if q.delay[key] == nil {
+			q.delay[key] = map[string]delayed{}
+		}
+		q.delay[key][jobID] = delayed{at: runAt, priority: priority}
+		delete(q.ready[key], jobID)
+		return nil
+	}
+	delete(q.delay[key], jobID)
+	q.makeReady(key, jobID, ReadyScore(runAt, priority, q.starvationBound))
+	return nil
+}
+
+// makeReady adds jobID to a ready set and wakes blocked dequeues. q.mu must
+// be held.
+func (q *Memory) makeReady(key, jobID string, score float64) {
+	if q.ready[key] == nil {
+		q.ready[key] = map[string]float64{}
+	}
+	q.ready[key][jobID] = score
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// Dequeue pops the lowest-scored jobs across the allowed types, blocking up
+// to block for the first one.
+func (q *Memory) Dequeue(ctx context.Context, tenant string, f Filter, block time.Duration, count int) ([]string, error) {
+	deadline := time.NewTimer(block)
+	defer deadline.Stop()
+	for {
+		q.mu.Lock()
+		ids := q.pop(tenant, f, count)
+		wake := q.wake
+		q.mu.Unlock()
+		if len(ids) > 0 {
+			return ids, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, nil
+		case <-wake:
+		}
+	}
+}
+
+// pop takes up to count ready jobs for tenant. q.mu must be held.
+func (q *Memory) pop(tenant string, f Filter, count int) []string {
+	types := f.Types
+	if len(types) == 0 {
+		for t := range q.types[tenant] {
+			types = append(types, t)
+		}
+	}
+	type entry struct {
+		id, typ string
+		score   float64
+	}
+	var cands []entry
+	for _, t := range types {
+		if f.Skip[t] {
+			continue
+		}
+		for id, score := range q.ready[tenant+":"+t] {
+			cands = append(cands, entry{id, t, score})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].score < cands[j].score })
+
+	now := time.Now()
+	var ids []string
+	for _, c := range cands {
+		if len(ids) == count {
+			break
+		}
+		if l, ok := f.Limits[c.typ]; ok && !q.take(tenant, l, now) {
+			continue
+		}
+		delete(q.ready[tenant+":"+c.typ], c.id)
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+// take draws one token from the bucket for l, refilled like takeTokens.
+// q.mu must be held.
+func (q *Memory) take(tenant string, l RateLimit, now time.Time) bool {
+	burst := float64(max(l.QPS, 1))
+	b := q.buckets[RateLimitKey(tenant, l.Key)]
+	if b == nil {
+		b = &bucket{tokens: burst, ts: now}
+		q.buckets[RateLimitKey(tenant, l.Key)] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.ts).Seconds()*float64(l.QPS))
+	b.ts = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (q *Memory) MoveDue(ctx context.Context, tenant string, now time.Time, batch int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for typ := range q.types[tenant] {
+		key := tenant + ":" + typ
+		moved := 0
+		for id, d := range q.delay[key] {
+			if moved == batch {
+				break
+			}
+			if d.at.After(now) {
+				continue
+			}
+			delete(q.delay[key], id)
+			q.makeReady(key, id, ReadyScore(d.at, d.priority, q.starvationBound))
+			moved++
+		}
+	}
+	return nil
+}
+
+// Ack is a no-op: a popped job is already gone from its ready set.
+func (q *Memory) Ack(ctx context.Context, tenant, jobID string) error { return nil }
+
+func (q *Memory) Missing(ctx context.Context, tenant string, jobs []Ref) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []string
+	for _, j := range jobs {
+		key := tenant + ":" + j.Type
+		_, ready := q.ready[key][j.ID]
+		_, delayed := q.delay[key][j.ID]
+		if !ready && !delayed {
+			out = append(out, j.ID)
+		}
+	}
+	return out, nil
+}
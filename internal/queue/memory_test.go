@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// A job is either ready or delayed, never both.
+func TestMemoryReschedule(t *testing.T) {
+	q := NewMemory(time.Minute)
+	ctx := context.Background()
+
+	mustEnqueue(t, q, "a", "j1", 0, time.Now().Add(time.Hour))
+	mustEnqueue(t, q, "a", "j1", 0, time.Now())
+	if err := q.MoveDue(ctx, "t", time.Now().Add(2*time.Hour), 10); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := q.Dequeue(ctx, "t", Filter{}, 0, 10); !slices.Equal(ids, []string{"j1"}) {
+		t.Fatalf("Dequeue = %v, want j1 once", ids)
+	}
+	if ids, _ := q.Dequeue(ctx, "t", Filter{}, 0, 10); len(ids) != 0 {
+		t.Fatalf("popped %v again", ids)
+	}
+
+	mustEnqueue(t, q, "a", "j2", 0, time.Now())
+	mustEnqueue(t, q, "a", "j2", 0, time.Now().Add(time.Hour))
+	if ids, _ := q.Dequeue(ctx, "t", Filter{}, 0, 10); len(ids) != 0 {
+		t.Fatalf("popped delayed job: %v", ids)
+	}
+	if lost, _ := q.Missing(ctx, "t", []Ref{{ID: "j2", Type: "a"}}); len(lost) != 0 {
+		t.Errorf("Missing = %v", lost)
+	}
+}
@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	r "github.com/redis/go-redis/v9"
+)
+
+// RateLimit caps how many jobs of a type are leased per second. Types that
+// share a Key draw from the same bucket.
+type RateLimit struct {
+	Key string
+	QPS int
+}
+
+func RateLimitKey(tenant, key string) string { return "ratelimit:" + tenant + ":" + key }
+
+// bucketLua is shared by the scripts that draw from rate limit buckets. It
+// defines take(key, rate, burst, want, now), a token bucket refilled at rate
+// tokens/s up to burst that grants up to want tokens (0 = just report) and
+// returns granted, tokens left. now comes from Redis TIME, which keeps every
+// API replica on one clock.
+const bucketLua = `
+local function take(key, rate, burst, want, now)
+  local b = redis.call('HMGET', key, 'tokens', 'ts')
+  local tokens = tonumber(b[1]) or burst
+  local ts = tonumber(b[2]) or now
+  tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+  local got = math.min(want, math.floor(tokens))
+  tokens = tokens - got
+  redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+  redis.call('PEXPIRE', key, math.ceil(burst / rate * 1000) + 1000)
+  return got, math.floor(tokens)
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// takeTokens draws from bucket KEYS[1] at rate ARGV[1] and burst ARGV[2],
+// wanting ARGV[3] tokens. It returns {granted, tokens left}.
+var takeTokens = r.NewScript(bucketLua + `
+local got, left = take(KEYS[1], tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), now)
+return {got, left}
+`)
+
+// take grants up to want tokens from the bucket for l and reports how many
+// whole tokens remain.
+func take(ctx context.Context, rdb r.Scripter, tenant string, l RateLimit, want int) (got, left int, err error) {
+	burst := max(l.QPS, 1) // one second's worth
+	res, err := takeTokens.Run(ctx, rdb, []string{RateLimitKey(tenant, l.Key)}, l.QPS, burst, want).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(res[0]), int(res[1]), nil
+}
+
+// openTypes drops the types f skips and the rate-limited types whose bucket
+// is currently empty.
+func openTypes(ctx context.Context, rdb r.Scripter, tenant string, types []string, f Filter) ([]string, error) {
+	if len(f.Limits) == 0 && len(f.Skip) == 0 {
+		return types, nil
+	}
+	open := make([]string, 0, len(types))
+	for _, t := range types {
+		if f.Skip[t] {
+			continue
+		}
+		if l, ok := f.Limits[t]; ok {
+			if _, left, err := take(ctx, rdb, tenant, l, 0); err != nil {
+				return nil, err
+			} else if left == 0 {
+				continue
+			}
+		}
+		open = append(open, t)
+	}
+	return open, nil
+}
+
+// idle waits out block when there is nothing to block on, so idle workers
+// don't spin.
+func idle(ctx context.Context, block time.Duration) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(block):
+		return nil, nil
+	}
+}
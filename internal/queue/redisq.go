@@ -2,45 +2,210 @@ package queue
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 	"time"
 
 	r "github.com/redis/go-redis/v9"
 )
 
-type RedisQ struct{ rdb *r.Client }
+// Key layout: every job type gets its own ready set and delay set, and
+// TypesKey tracks which types a tenant has ever enqueued so lease and the
+// scheduler can discover them. WakeKey is a list that gets a token whenever
+// one of the tenant's jobs becomes ready, for idle dequeues to block on.
+func ReadyKey(tenant, typ string) string { return "queue:" + tenant + ":" + typ }
+func DelayKey(tenant, typ string) string { return "delay:" + tenant + ":" + typ }
+func TypesKey(tenant string) string      { return "types:" + tenant }
+func WakeKey(tenant string) string       { return "wake:" + tenant }
 
-func New(rdb *r.Client) *RedisQ { return &RedisQ{rdb} }
+// MaxPriority is the highest effective priority; larger values are clamped.
+const MaxPriority = 1000
 
-func (q *RedisQ) Enqueue(ctx context.Context, tenant string, jobID string, runAt time.Time) error {
+// ReadyScore orders the ready sets (lowest score is leased first). A job
+// gets a head start of up to bound over jobs that became ready at the same
+// time, proportional to its priority in [0, MaxPriority]. A job is therefore
+// never overtaken by work that became ready more than bound after it, which
+// keeps low-priority jobs from starving.
+func ReadyScore(readyAt time.Time, priority int, bound time.Duration) float64 {
+	priority = min(max(priority, 0), MaxPriority)
+	boost := bound.Milliseconds() * int64(priority) / MaxPriority
+	return float64(readyAt.UnixMilli() - boost)
+}
+
+// DelayMember encodes a delayed job so its priority survives the move to the
+// ready set. ParseDelayMember reverses it.
+func DelayMember(jobID string, priority int) string {
+	return strconv.Itoa(priority) + ":" + jobID
+}
+
+func ParseDelayMember(m string) (jobID string, priority int) {
+	p, id, ok := strings.Cut(m, ":")
+	if !ok {
+		return m, 0
+	}
+	n, _ := strconv.Atoi(p)
+	return id, n
+}
+
+type RedisQ struct {
+	rdb             *r.Client
+	starvationBound time.Duration
+}
+
+func New(rdb *r.Client, starvationBound time.Duration) *RedisQ {
+	return &RedisQ{rdb: rdb, starvationBound: starvationBound}
+}
+
+// Enqueue routes jobID to the ready set (or delay set) of its job type.
+func (q *RedisQ) Enqueue(ctx context.Context, tenant, typ, jobID string, priority int, runAt time.Time) error {
+	dueAt := ""
 	if time.Until(runAt) > 0 {
-		return q.rdb.ZAdd(ctx, "delay:"+tenant, r.Z{Score: float64(runAt.Unix()), Member: jobID}).Err()
+		dueAt = strconv.FormatInt(runAt.UnixMilli(), 10)
 	}
-	return q.rdb.LPush(ctx, "queue:"+tenant, jobID).Err()
+	return scheduleJob.Run(ctx, q.rdb,
+		[]string{TypesKey(tenant), ReadyKey(tenant, typ), DelayKey(tenant, typ), WakeKey(tenant)},
+		typ, jobID, DelayMember(jobID, priority), ReadyScore(runAt, priority, q.starvationBound), dueAt).Err()
 }
 
-func (q *RedisQ) Dequeue(ctx context.Context, tenant string, block time.Duration) (string, error) {
-	res, err := q.rdb.BRPop(ctx, block, "queue:"+tenant).Result()
-	if err != nil {
-		return "", err
+// Types returns every job type the tenant has queues for.
+func (q *RedisQ) Types(ctx context.Context, tenant string) ([]string, error) {
+	return q.rdb.SMembers(ctx, TypesKey(tenant)).Result()
+}
+
+// maxWakeWait caps a single BLPOP on WakeKey. It keeps the call under the
+// client's read timeout, and a dequeue whose wakeup went to another
+// waiter (e.g. one with other capabilities) retries at least this often.
+const maxWakeWait = 1 * time.Second
+
+// Dequeue pops up to count job IDs from a single ready set with the
+// leasePop script. While nothing is ready it blocks on WakeKey for up to
+// block and pops again on each wakeup. Only the ready sets of the types
+// allowed by f are considered, and rate-limited types are only popped from
+// while their token bucket has tokens.
+func (q *RedisQ) Dequeue(ctx context.Context, tenant string, f Filter, block time.Duration, count int) ([]string, error) {
+	types := f.Types
+	if len(types) == 0 {
+		var err error
+		if types, err = q.Types(ctx, tenant); err != nil {
+			return nil, err
+		}
+	}
+	open := make([]string, 0, len(types))
+	for _, t := range types {
+		if !f.Skip[t] {
+			open = append(open, t)
+		}
 	}
-	if len(res) == 2 {
-		return res[1], nil
+	if len(open) == 0 {
+		return idle(ctx, block)
+	}
+
+	// a bucket refilling wakes nobody, so a rate-limited type is retried
+	// once per token instead
+	slice := maxWakeWait
+	n := len(open)
+	keys := make([]string, 2*n)
+	args := make([]any, 1+n)
+	args[0] = count
+	// rotate the keys so ties between types don't always go the same way
+	off := rand.IntN(n)
+	for i := range open {
+		t := open[(off+i)%n]
+		keys[i] = ReadyKey(tenant, t)
+		keys[n+i] = RateLimitKey(tenant, "type:"+t) // untouched while args[1+i] is 0
+		args[1+i] = 0
+		if l, ok := f.Limits[t]; ok {
+			keys[n+i] = RateLimitKey(tenant, l.Key)
+			args[1+i] = l.QPS
+			if l.QPS > 0 {
+				slice = min(slice, time.Second/time.Duration(l.QPS))
+			}
+		}
+	}
+
+	deadline := time.Now().Add(block)
+	for {
+		ids, err := leasePop.Run(ctx, q.rdb, keys, args...).StringSlice()
+		if err != nil && err != r.Nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			return ids, nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, nil
+		}
+		if err := q.awaitReady(ctx, tenant, min(wait, slice)); err != nil {
+			return nil, err
+		}
 	}
-	return "", nil
 }
 
-func (q *RedisQ) MoveDue(ctx context.Context, tenant string, now int64, batch int64) error {
-	// fetch due IDs
-	ids, err := q.rdb.ZRangeByScore(ctx, "delay:"+tenant, &r.ZRangeBy{Min: "-inf", Max: fmt.Sprintf("%d", now), Offset: 0, Count: batch}).Result()
-	if err != nil || len(ids) == 0 {
+// awaitReady blocks until a job of tenant becomes ready or wait passes.
+func (q *RedisQ) awaitReady(ctx context.Context, tenant string, wait time.Duration) error {
+	if wait < time.Millisecond {
+		return nil // BLPOP would read a 0 timeout as forever
+	}
+	// BLPOP takes fractional seconds since Redis 6; go-redis' BLPop rounds
+	// to whole ones
+	err := q.rdb.Do(ctx, "blpop", WakeKey(tenant), strconv.FormatFloat(wait.Seconds(), 'f', 3, 64)).Err()
+	if err != nil && !errors.Is(err, r.Nil) {
 		return err
 	}
-	pipe := q.rdb.TxPipeline()
-	for _, id := range ids {
-		pipe.LPush(ctx, "queue:"+tenant, id)
-		pipe.ZRem(ctx, "delay:"+tenant, id)
+	return ctx.Err()
+}
+
+// MoveDue promotes due jobs from each type's delay set to its ready set.
+func (q *RedisQ) MoveDue(ctx context.Context, tenant string, now time.Time, batch int) error {
+	types, err := q.Types(ctx, tenant)
+	if err != nil {
+		return err
+	}
+	for _, typ := range types {
+		err := moveDue.Run(ctx, q.rdb, []string{DelayKey(tenant, typ), ReadyKey(tenant, typ), WakeKey(tenant)},
+			now.UnixMilli(), batch, q.starvationBound.Milliseconds(), MaxPriority).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ack is a no-op: a popped job is already gone from its ready set.
+func (q *RedisQ) Ack(ctx context.Context, tenant, jobID string) error { return nil }
+
+// Missing looks each job up in its ready and delay sets in one pipeline.
+func (q *RedisQ) Missing(ctx context.Context, tenant string, jobs []Ref) ([]string, error) {
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	pipe := q.rdb.Pipeline()
+	found := make([]*r.Cmd, len(jobs))
+	for i, j := range jobs {
+		found[i] = queuedJob.Eval(ctx, pipe, []string{ReadyKey(tenant, j.Type), DelayKey(tenant, j.Type)},
+			j.ID, DelayMember(j.ID, j.Priority))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return missing(jobs, found)
+}
+
+// missing returns the IDs of jobs whose lookup answered 0. found[i] is a
+// script run for jobs[i] that answers 1 when the backend holds it.
+func missing(jobs []Ref, found []*r.Cmd) ([]string, error) {
+	var out []string
+	for i, j := range jobs {
+		n, err := found[i].Int()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			out = append(out, j.ID)
+		}
 	}
-	_, err = pipe.Exec(ctx)
-	return err
+	return out, nil
 }
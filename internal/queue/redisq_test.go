@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	r "github.com/redis/go-redis/v9"
+)
+
+func newTestRedisQ(t *testing.T) (*RedisQ, *r.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := r.NewClient(&r.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return New(rdb, time.Minute), rdb
+}
+
+func TestRedisQOrder(t *testing.T) {
+	q, _ := newTestRedisQ(t)
+	ctx := context.Background()
+	now := time.Now()
+	// a high priority job overtakes older ones only within the bound
+	mustEnqueue(t, q, "a", "old-low", 0, now.Add(-2*time.Minute))
+	mustEnqueue(t, q, "a", "low", 0, now.Add(-time.Second))
+	mustEnqueue(t, q, "b", "high", 1000, now)
+	mustEnqueue(t, q, "b", "high", 1000, now) // idempotent
+
+	var got []string
+	for range 4 {
+		ids, err := q.Dequeue(ctx, "t", Filter{}, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ids...)
+	}
+	if want := []string{"old-low", "high", "low"}; !slices.Equal(got, want) {
+		t.Fatalf("Dequeue order = %v, want %v", got, want)
+	}
+}
+
+func TestRedisQDequeueBlocksUntilReady(t *testing.T) {
+	q, _ := newTestRedisQ(t)
+	ctx := context.Background()
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		mustEnqueue(t, q, "a", "j1", 0, time.Now())
+	}()
+	start := time.Now()
+	ids, err := q.Dequeue(ctx, "t", Filter{Types: []string{"a"}}, 3*time.Second, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []string{"j1"}) {
+		t.Fatalf("ids = %v", ids)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("woke after %v, want right after the enqueue", d)
+	}
+
+	// delayed jobs wake waiters when MoveDue promotes them
+	mustEnqueue(t, q, "a", "d1", 0, time.Now().Add(100*time.Millisecond))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		if err := q.MoveDue(ctx, "t", time.Now(), 10); err != nil {
+			t.Error(err)
+		}
+	}()
+	start = time.Now()
+	ids, _ = q.Dequeue(ctx, "t", Filter{Types: []string{"a"}}, 3*time.Second, 1)
+	if !slices.Equal(ids, []string{"d1"}) {
+		t.Fatalf("ids = %v", ids)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("woke after %v, want right after MoveDue", d)
+	}
+}
+
+func TestRedisQDequeueTimesOut(t *testing.T) {
+	q, _ := newTestRedisQ(t)
+	start := time.Now()
+	ids, err := q.Dequeue(context.Background(), "t", Filter{Types: []string{"a"}}, 300*time.Millisecond, 1)
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("Dequeue = %v, %v", ids, err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond || d > 2*time.Second {
+		t.Errorf("returned after %v", d)
+	}
+}
+
+func TestRedisQRateLimit(t *testing.T) {
+	q, _ := newTestRedisQ(t)
+	ctx := context.Background()
+	for _, id := range []string{"j1", "j2", "j3"} {
+		mustEnqueue(t, q, "a", id, 0, time.Now())
+	}
+	f := Filter{Limits: map[string]RateLimit{"a": {Key: "type:a", QPS: 2}}}
+	ids, err := q.Dequeue(ctx, "t", f, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("popped %v with a burst of 2", ids)
+	}
+	if ids, _ := q.Dequeue(ctx, "t", f, 0, 10); len(ids) != 0 {
+		t.Fatalf("popped %v from an empty bucket", ids)
+	}
+}
+
+// A batch larger than the queue is charged only for the jobs it gets.
+func TestRedisQRateLimitShortQueue(t *testing.T) {
+	q, _ := newTestRedisQ(t)
+	ctx := context.Background()
+	f := Filter{Limits: map[string]RateLimit{"a": {Key: "type:a", QPS: 10}}}
+	mustEnqueue(t, q, "a", "j0", 0, time.Now())
+	if ids, err := q.Dequeue(ctx, "t", f, 0, 10); err != nil || len(ids) != 1 {
+		t.Fatalf("Dequeue = %v, %v", ids, err)
+	}
+	for _, id := range []string{"j1", "j2", "j3", "j4", "j5"} {
+		mustEnqueue(t, q, "a", id, 0, time.Now())
+	}
+	if ids, err := q.Dequeue(ctx, "t", f, 0, 10); err != nil || len(ids) != 5 {
+		t.Fatalf("Dequeue after the first batch = %v, %v; want all 5", ids, err)
+	}
+}
+
+func TestRedisQMissing(t *testing.T) {
+	q, _ := newTestRedisQ(t)
+	ctx := context.Background()
+	mustEnqueue(t, q, "a", "ready", 5, time.Now())
+	mustEnqueue(t, q, "a", "delayed", 5, time.Now().Add(time.Hour))
+	// a lost job first: its lookup must not make the others look lost
+	got, err := q.Missing(ctx, "t", []Ref{
+		{ID: "lost", Type: "a"},
+		{ID: "ready", Type: "a", Priority: 5},
+		{ID: "delayed", Type: "a", Priority: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []string{"lost"}) {
+		t.Errorf("Missing = %v", got)
+	}
+}
+
+func mustEnqueue(t *testing.T, q Backend, typ, id string, priority int, runAt time.Time) {
+	t.Helper()
+	if err := q.Enqueue(context.Background(), "t", typ, id, priority, runAt); err != nil {
+		t.Error(err)
+	}
+}
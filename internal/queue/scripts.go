@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+
+	r "github.com/redis/go-redis/v9"
+)
+
+// The RedisQ operations that touch more than one key run as Lua scripts, so
+// each is atomic and a single round trip. Script.Run calls EVALSHA and only
+// falls back to EVAL when Redis has lost its script cache.
+
+// wakeLua defines wake(key, n), which pushes up to n tokens onto the wakeup
+// list key for blocked dequeues. The list is capped and expires, so tokens
+// don't pile up while nobody is waiting.
+const wakeLua = `
+local function wake(key, n)
+  for _ = 1, math.min(n, 100) do
+    redis.call('LPUSH', key, 1)
+  end
+  redis.call('LTRIM', key, 0, 99)
+  redis.call('PEXPIRE', key, 60000)
+end
+`
+
+// scheduleJob is the retry-schedule script behind Enqueue. It adds ARGV[1]
+// to the types set KEYS[1] and puts job ARGV[2] in exactly one of the ready
+// set KEYS[2] (score ARGV[4]) or, when ARGV[5] holds a due time, the delay
+// set KEYS[3] as member ARGV[3]. Removing it from the other set keeps a
+// retried job from being both ready and delayed. A job made ready wakes a
+// dequeue blocked on KEYS[4].
+var scheduleJob = r.NewScript(wakeLua + `
+redis.call('SADD', KEYS[1], ARGV[1])
+if ARGV[5] ~= '' then
+  redis.call('ZREM', KEYS[2], ARGV[2])
+  redis.call('ZADD', KEYS[3], ARGV[5], ARGV[3])
+else
+  redis.call('ZREM', KEYS[3], ARGV[3])
+  redis.call('ZADD', KEYS[2], ARGV[4], ARGV[2])
+  wake(KEYS[4], 1)
+end
+return 0
+`)
+
+// moveDue promotes up to ARGV[2] members of delay set KEYS[1] due at ARGV[1]
+// (unix ms) to ready set KEYS[2], scored like ReadyScore with starvation
+// bound ARGV[3] ms and MaxPriority ARGV[4], and wakes as many dequeues
+// blocked on KEYS[3]. It returns how many it moved.
+var moveDue = r.NewScript(wakeLua + `
+local bound, maxp = tonumber(ARGV[3]), tonumber(ARGV[4])
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', 0, ARGV[2])
+for j = 1, #due, 2 do
+  local m = due[j]
+  local p, id = string.match(m, '^([^:]*):(.*)$')
+  if not id then
+    p, id = 0, m
+  end
+  p = math.min(math.max(tonumber(p) or 0, 0), maxp)
+  local score = tonumber(due[j + 1]) - math.floor(bound * p / maxp)
+  redis.call('ZADD', KEYS[2], score, id)
+  redis.call('ZREM', KEYS[1], m)
+end
+if #due > 0 then
+  wake(KEYS[3], #due / 2)
+end
+return #due / 2
+`)
+
+// leasePop pops up to ARGV[1] jobs from the ready set among KEYS[1..n] with
+// the most urgent head, skipping sets whose bucket KEYS[n+i] has no tokens
+// for lease rate ARGV[1+i] (0 = not rate limited). The pop is capped by the
+// tokens left, so nothing is popped that has to be put back, and only the
+// jobs the set holds are charged to the bucket. Ties go to the earlier key.
+var leasePop = r.NewScript(bucketLua + `
+local n = #KEYS / 2
+local count = tonumber(ARGV[1])
+local best, bestScore
+for i = 1, n do
+  local head = redis.call('ZRANGE', KEYS[i], 0, 0, 'WITHSCORES')
+  if head[1] and (not best or tonumber(head[2]) < bestScore) then
+    local rate = tonumber(ARGV[1 + i])
+    local open = true
+    if rate > 0 then
+      local _, left = take(KEYS[n + i], rate, math.max(rate, 1), 0, now)
+      open = left > 0
+    end
+    if open then
+      best, bestScore = i, tonumber(head[2])
+    end
+  end
+end
+if not best then
+  return {}
+end
+local rate = tonumber(ARGV[1 + best])
+count = math.min(count, redis.call('ZCARD', KEYS[best]))
+if rate > 0 then
+  count = take(KEYS[n + best], rate, math.max(rate, 1), count, now)
+end
+local popped = redis.call('ZPOPMIN', KEYS[best], count)
+local ids = {}
+for j = 1, #popped, 2 do
+  ids[#ids + 1] = popped[j]
+end
+return ids
+`)
+
+// queuedJob answers 1 when job ARGV[1] is in ready set KEYS[1] or member
+// ARGV[2] in delay set KEYS[2], and 0 otherwise. Missing pipelines it
+// instead of ZSCORE because go-redis copies a nil reply to the first command
+// of a pipeline onto every command after it.
+var queuedJob = r.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) or redis.call('ZSCORE', KEYS[2], ARGV[2]) then
+  return 1
+end
+return 0
+`)
+
+// LoadScripts loads every queue script into the Redis script cache, so the
+// first calls go straight to EVALSHA. Call it once at startup.
+func LoadScripts(ctx context.Context, rdb r.Scripter) error {
+	for _, s := range []*r.Script{takeTokens, scheduleJob, moveDue, leasePop, queuedJob, streamAdd, streamAck, streamHolds} {
+		if err := s.Load(ctx, rdb).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
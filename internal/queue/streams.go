@@ -0,0 +1,294 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	r "github.com/redis/go-redis/v9"
+)
+
+// StreamKey is the stream of ready jobs for one type, read by the Group
+// consumer group. EntryKey maps each of the tenant's job IDs to its stream
+// and entry ID. Whether a job is waiting to be read or already popped is
+// read off the group's pending entries list, so XREADGROUP needs no
+// bookkeeping of its own and a replica dying right after it loses nothing.
+func StreamKey(tenant, typ string) string { return "stream:" + tenant + ":" + typ }
+func EntryKey(tenant string) string       { return "entries:" + tenant }
+
+// streamLua defines entry(stream, entries, group, id), which returns the
+// entry of job id in stream and whether group has delivered it, or nil
+// when it has none there, and drop(stream, entries, group, id, eid), which
+// removes entry eid of job id.
+const streamLua = `
+local function entry(stream, entries, group, id)
+  local ref = redis.call('HGET', entries, id)
+  if not ref or redis.call('EXISTS', stream) == 0 then
+    return nil
+  end
+  local key, eid = string.match(ref, '^(.*) (.-)$')
+  if key ~= stream then
+    return nil
+  end
+  if #redis.call('XPENDING', stream, group, eid, eid, 1) > 0 then
+    return eid, true
+  end
+  if #redis.call('XRANGE', stream, eid, eid) > 0 then
+    return eid, false
+  end
+  return nil
+end
+local function drop(stream, entries, group, id, eid)
+  redis.call('XACK', stream, group, eid)
+  redis.call('XDEL', stream, eid)
+  redis.call('HDEL', entries, id)
+end
+`
+
+// streamAdd appends job ARGV[1] to stream KEYS[1] and records the entry in
+// KEYS[2], unless the job already has an entry there that group ARGV[2]
+// hasn't read. An entry the group has read is dropped and replaced, e.g.
+// when an expired lease is requeued or a popped job was never leased.
+var streamAdd = r.NewScript(streamLua + `
+local eid, read = entry(KEYS[1], KEYS[2], ARGV[2], ARGV[1])
+if eid and not read then
+  return 0
+end
+if eid then
+  drop(KEYS[1], KEYS[2], ARGV[2], ARGV[1], eid)
+end
+eid = redis.call('XADD', KEYS[1], '*', 'job', ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], KEYS[1] .. ' ' .. eid)
+return 1
+`)
+
+// streamAck drops the entry of job ARGV[1] from stream KEYS[1] once group
+// ARGV[2] has read it, or whether read or not when ARGV[3] is 1.
+var streamAck = r.NewScript(streamLua + `
+local eid, read = entry(KEYS[1], KEYS[2], ARGV[2], ARGV[1])
+if eid and (read or ARGV[3] == '1') then
+  drop(KEYS[1], KEYS[2], ARGV[2], ARGV[1], eid)
+end
+return 0
+`)
+
+// streamHolds answers 1 when job ARGV[1] has an entry in stream KEYS[1]
+// that group ARGV[2] hasn't read yet or member ARGV[3] is in delay set
+// KEYS[3], and 0 otherwise.
+var streamHolds = r.NewScript(streamLua + `
+local eid, read = entry(KEYS[1], KEYS[2], ARGV[2], ARGV[1])
+if (eid and not read) or redis.call('ZSCORE', KEYS[3], ARGV[3]) then
+  return 1
+end
+return 0
+`)
+
+// Group is the consumer group every API replica reads the streams with.
+const Group = "enq"
+
+// Streams is a Backend on Redis Streams. Popped jobs stay in the group's
+// pending entries list until acked, so XPENDING shows what each consumer is
+// holding. Delayed jobs use the same delay sets as RedisQ.
+//
+// Streams are first in, first out: priority only orders delayed jobs that
+// become due in the same MoveDue.
+type Streams struct {
+	rdb      *r.Client
+	consumer string
+	groups   sync.Map // stream keys known to have the group
+}
+
+// NewStreams reads as consumer, which should be unique per API replica
+// (e.g. the hostname).
+func NewStreams(rdb *r.Client, consumer string) *Streams {
+	return &Streams{rdb: rdb, consumer: consumer}
+}
+
+// ensureGroup creates the consumer group (and the stream) on first use.
+func (q *Streams) ensureGroup(ctx context.Context, key string) error {
+	if _, ok := q.groups.Load(key); ok {
+		return nil
+	}
+	err := q.rdb.XGroupCreateMkStream(ctx, key, Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	q.groups.Store(key, true)
+	return nil
+}
+
+// Enqueue appends jobID to its type's stream, or to the delay set when runAt
+// is in the future. A job already waiting in the stream is left alone, and
+// an entry for it that has been popped is replaced, e.g. when an expired
+// lease is requeued. A job is only ever in one of the stream and the delay
+// set.
+func (q *Streams) Enqueue(ctx context.Context, tenant, typ, jobID string, priority int, runAt time.Time) error {
+	key := StreamKey(tenant, typ)
+	if err := q.ensureGroup(ctx, key); err != nil {
+		return err
+	}
+	keys := []string{key, EntryKey(tenant)}
+	pipe := q.rdb.TxPipeline()
+	pipe.SAdd(ctx, TypesKey(tenant), typ)
+	if time.Until(runAt) > 0 {
+		streamAck.Eval(ctx, pipe, keys, jobID, Group, 1)
+		pipe.ZAdd(ctx, DelayKey(tenant, typ), r.Z{Score: float64(runAt.UnixMilli()), Member: DelayMember(jobID, priority)})
+	} else {
+		pipe.ZRem(ctx, DelayKey(tenant, typ), DelayMember(jobID, priority))
+		streamAdd.Eval(ctx, pipe, keys, jobID, Group)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Dequeue reads up to count new entries with XREADGROUP across the streams
+// of the types allowed by f. Entries beyond count or over a rate limit are
+// re-added at the tail of their stream.
+func (q *Streams) Dequeue(ctx context.Context, tenant string, f Filter, block time.Duration, count int) ([]string, error) {
+	types := f.Types
+	if len(types) == 0 {
+		var err error
+		if types, err = q.rdb.SMembers(ctx, TypesKey(tenant)).Result(); err != nil {
+			return nil, err
+		}
+	}
+	types, err := openTypes(ctx, q.rdb, tenant, types, f)
+	if err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return idle(ctx, block)
+	}
+
+	streams := make([]string, 0, 2*len(types))
+	for _, t := range types {
+		key := StreamKey(tenant, t)
+		if err := q.ensureGroup(ctx, key); err != nil {
+			return nil, err
+		}
+		streams = append(streams, key)
+	}
+	for range types {
+		streams = append(streams, ">")
+	}
+	if block < time.Millisecond {
+		// BLOCK 0 waits forever; go-redis sends no BLOCK for negative
+		// durations
+		block = -1
+	}
+	res, err := q.rdb.XReadGroup(ctx, &r.XReadGroupArgs{
+		Group: Group, Consumer: q.consumer, Streams: streams, Count: int64(count), Block: block,
+	}).Result()
+	if errors.Is(err, r.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	pipe := q.rdb.TxPipeline()
+	putBack := func(stream string, m r.XMessage) {
+		// the job goes back to the tail as a new entry
+		streamAdd.Eval(ctx, pipe, []string{stream, EntryKey(tenant)}, fmt.Sprint(m.Values["job"]), Group)
+		pipe.XAck(ctx, stream, Group, m.ID)
+		pipe.XDel(ctx, stream, m.ID)
+	}
+	for _, st := range res {
+		typ := strings.TrimPrefix(st.Stream, StreamKey(tenant, ""))
+		msgs := st.Messages
+		if l, ok := f.Limits[typ]; ok && len(msgs) > 0 {
+			got, _, err := take(ctx, q.rdb, tenant, l, len(msgs))
+			if err != nil {
+				got = 0 // bucket unavailable: hand none of them out
+			}
+			for _, m := range msgs[got:] {
+				putBack(st.Stream, m)
+			}
+			msgs = msgs[:got]
+		}
+		for _, m := range msgs {
+			if len(ids) == count {
+				putBack(st.Stream, m)
+				continue
+			}
+			id, _ := m.Values["job"].(string)
+			ids = append(ids, id)
+		}
+	}
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// MoveDue appends due jobs from each type's delay set to its stream.
+func (q *Streams) MoveDue(ctx context.Context, tenant string, now time.Time, batch int) error {
+	types, err := q.rdb.SMembers(ctx, TypesKey(tenant)).Result()
+	if err != nil {
+		return err
+	}
+	for _, typ := range types {
+		zs, err := q.rdb.ZRangeByScore(ctx, DelayKey(tenant, typ), &r.ZRangeBy{
+			Min: "-inf", Max: fmt.Sprintf("%d", now.UnixMilli()), Offset: 0, Count: int64(batch),
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(zs) == 0 {
+			continue
+		}
+		if err := q.ensureGroup(ctx, StreamKey(tenant, typ)); err != nil {
+			return err
+		}
+		pipe := q.rdb.TxPipeline()
+		for _, m := range zs {
+			id, _ := ParseDelayMember(m)
+			streamAdd.Eval(ctx, pipe, []string{StreamKey(tenant, typ), EntryKey(tenant)}, id, Group)
+			pipe.ZRem(ctx, DelayKey(tenant, typ), m)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ack drops jobID's stream entry once it has been popped. An entry still
+// waiting to be read is left alone: it was added by a later Enqueue.
+func (q *Streams) Ack(ctx context.Context, tenant, jobID string) error {
+	ref, err := q.rdb.HGet(ctx, EntryKey(tenant), jobID).Result()
+	if errors.Is(err, r.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	key, _, _ := strings.Cut(ref, " ")
+	return streamAck.Run(ctx, q.rdb, []string{key, EntryKey(tenant)}, jobID, Group, 0).Err()
+}
+
+// Missing looks each job up in its type's stream and delay set. A job whose
+// entry has been popped counts as missing: the replica that read it either
+// gave up before leasing it or died before it could, and Enqueue replaces
+// that entry with a new one.
+func (q *Streams) Missing(ctx context.Context, tenant string, jobs []Ref) ([]string, error) {
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	pipe := q.rdb.Pipeline()
+	found := make([]*r.Cmd, len(jobs))
+	for i, j := range jobs {
+		found[i] = streamHolds.Eval(ctx, pipe, []string{StreamKey(tenant, j.Type), EntryKey(tenant), DelayKey(tenant, j.Type)},
+			j.ID, Group, DelayMember(j.ID, j.Priority))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return missing(jobs, found)
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	r "github.com/redis/go-redis/v9"
+)
+
+func newTestStreams(t *testing.T) (*Streams, *r.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := r.NewClient(&r.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewStreams(rdb, "c1"), rdb
+}
+
+func TestStreamsDequeue(t *testing.T) {
+	q, _ := newTestStreams(t)
+	ctx := context.Background()
+	mustEnqueue(t, q, "a", "j1", 0, time.Now())
+	mustEnqueue(t, q, "a", "j1", 0, time.Now()) // idempotent
+	mustEnqueue(t, q, "a", "j2", 0, time.Now())
+	ids, err := q.Dequeue(ctx, "t", Filter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []string{"j1", "j2"}) {
+		t.Fatalf("Dequeue = %v", ids)
+	}
+}
+
+func TestStreamsPutBack(t *testing.T) {
+	q, _ := newTestStreams(t)
+	ctx := context.Background()
+	for _, id := range []string{"j1", "j2", "j3"} {
+		mustEnqueue(t, q, "a", id, 0, time.Now())
+	}
+	ids, err := q.Dequeue(ctx, "t", Filter{}, 0, 2)
+	if err != nil || !slices.Equal(ids, []string{"j1", "j2"}) {
+		t.Fatalf("Dequeue = %v, %v", ids, err)
+	}
+	if ids, _ := q.Dequeue(ctx, "t", Filter{}, 0, 2); !slices.Equal(ids, []string{"j3"}) {
+		t.Fatalf("second Dequeue = %v", ids)
+	}
+}
+
+// A replica that dies between XREADGROUP and leasing leaves the entry
+// pending. Missing reports the job and Enqueue hands it out again.
+func TestStreamsLostRead(t *testing.T) {
+	q, rdb := newTestStreams(t)
+	ctx := context.Background()
+	mustEnqueue(t, q, "a", "j1", 0, time.Now())
+	err := rdb.XReadGroup(ctx, &r.XReadGroupArgs{
+		Group: Group, Consumer: "crashed", Streams: []string{StreamKey("t", "a"), ">"}, Count: 10, Block: -1,
+	}).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lost, err := q.Missing(ctx, "t", []Ref{{ID: "j1", Type: "a"}})
+	if err != nil || !slices.Equal(lost, []string{"j1"}) {
+		t.Fatalf("Missing = %v, %v", lost, err)
+	}
+	mustEnqueue(t, q, "a", "j1", 0, time.Now())
+	if ids, _ := q.Dequeue(ctx, "t", Filter{}, 0, 10); !slices.Equal(ids, []string{"j1"}) {
+		t.Fatalf("Dequeue after the restore = %v", ids)
+	}
+	if err := q.Ack(ctx, "t", "j1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := rdb.XLen(ctx, StreamKey("t", "a")).Val(); n != 0 {
+		t.Errorf("%d entries left in the stream", n)
+	}
+	if p := rdb.XPending(ctx, StreamKey("t", "a"), Group).Val(); p.Count != 0 {
+		t.Errorf("%d entries left pending", p.Count)
+	}
+}
+
+func TestStreamsMissing(t *testing.T) {
+	q, _ := newTestStreams(t)
+	ctx := context.Background()
+	mustEnqueue(t, q, "a", "popped", 5, time.Now())
+	if _, err := q.Dequeue(ctx, "t", Filter{}, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	mustEnqueue(t, q, "a", "ready", 5, time.Now())
+	mustEnqueue(t, q, "a", "delayed", 5, time.Now().Add(time.Hour))
+	got, err := q.Missing(ctx, "t", []Ref{
+		{ID: "popped", Type: "a", Priority: 5},
+		{ID: "ready", Type: "a", Priority: 5},
+		{ID: "lost", Type: "a"},
+		{ID: "delayed", Type: "a", Priority: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []string{"popped", "lost"}) {
+		t.Errorf("Missing = %v", got)
+	}
+}
+
+// A job is either in the stream or delayed, never both.
+func TestStreamsReschedule(t *testing.T) {
+	q, _ := newTestStreams(t)
+	ctx := context.Background()
+	mustEnqueue(t, q, "a", "j1", 0, time.Now())
+	mustEnqueue(t, q, "a", "j1", 0, time.Now().Add(time.Hour))
+	if ids, _ := q.Dequeue(ctx, "t", Filter{}, 0, 10); len(ids) != 0 {
+		t.Fatalf("popped delayed job: %v", ids)
+	}
+	mustEnqueue(t, q, "a", "j1", 0, time.Now())
+	if err := q.MoveDue(ctx, "t", time.Now().Add(2*time.Hour), 10); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := q.Dequeue(ctx, "t", Filter{}, 0, 10); !slices.Equal(ids, []string{"j1"}) {
+		t.Fatalf("Dequeue = %v, want j1 once", ids)
+	}
+}
@@ -0,0 +1,175 @@
+// Package retry parses job backoff policies and computes retry delays.
+//
+// Policy strings:
+//
+//	fixed:10s                         always 10s
+//	linear:30s[,max=10m]              30s, 60s, 90s, ...
+//	exponential[:5s][,max=1h][,jitter=full|equal|none]
+//	                                  5s, 10s, 20s, ... (base defaults to 30s)
+//	10s,1m,5m,1h                      explicit schedule; the last delay repeats
+//
+// max defaults to 24h, or to no cap when the base is longer.
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBase = 30 * time.Second
+	defaultMax  = 24 * time.Hour // unless the base is longer
+	maxDelay    = time.Duration(math.MaxInt64)
+)
+
+type Kind string
+
+const (
+	Fixed       Kind = "fixed"
+	Linear      Kind = "linear"
+	Exponential Kind = "exponential"
+	Schedule    Kind = "schedule"
+)
+
+type Jitter string
+
+const (
+	JitterNone  Jitter = "none"
+	JitterFull  Jitter = "full"  // uniform in [0, d]
+	JitterEqual Jitter = "equal" // uniform in [d/2, d]
+)
+
+// Policy is a parsed backoff policy.
+type Policy struct {
+	Kind   Kind
+	Base   time.Duration
+	Max    time.Duration // 0 = no cap
+	Jitter Jitter
+	Delays []time.Duration // Schedule only
+}
+
+// Parse parses a policy string; see the package doc for the syntax.
+func Parse(s string) (Policy, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Policy{}, errors.New("empty backoff policy")
+	}
+	name, rest, _ := strings.Cut(s, ":")
+	switch Kind(name) {
+	case Fixed, Linear, Exponential:
+	default:
+		return parseSchedule(s)
+	}
+
+	p := Policy{Kind: Kind(name), Base: defaultBase, Jitter: JitterNone}
+	if rest == "" && p.Kind != Exponential {
+		return Policy{}, fmt.Errorf("%s backoff needs a delay, e.g. %s:10s", name, name)
+	}
+	var parts []string
+	if rest != "" {
+		parts = strings.Split(rest, ",")
+	}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		k, v, isOpt := strings.Cut(part, "=")
+		if !isOpt {
+			if i != 0 {
+				return Policy{}, fmt.Errorf("unexpected %q in backoff policy", part)
+			}
+			d, err := parseDelay(part)
+			if err != nil {
+				return Policy{}, err
+			}
+			p.Base = d
+			continue
+		}
+		switch k {
+		case "max":
+			d, err := parseDelay(v)
+			if err != nil {
+				return Policy{}, err
+			}
+			p.Max = d
+		case "jitter":
+			switch j := Jitter(v); j {
+			case JitterNone, JitterFull, JitterEqual:
+				p.Jitter = j
+			default:
+				return Policy{}, fmt.Errorf("unknown jitter %q (want none, full or equal)", v)
+			}
+		default:
+			return Policy{}, fmt.Errorf("unknown backoff option %q", k)
+		}
+	}
+	switch {
+	case p.Max == 0 && p.Base <= defaultMax:
+		p.Max = defaultMax
+	case p.Max != 0 && p.Max < p.Base:
+		return Policy{}, fmt.Errorf("backoff max %s is below base %s", p.Max, p.Base)
+	}
+	return p, nil
+}
+
+func parseSchedule(s string) (Policy, error) {
+	p := Policy{Kind: Schedule, Jitter: JitterNone}
+	for _, part := range strings.Split(s, ",") {
+		d, err := parseDelay(strings.TrimSpace(part))
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid backoff policy %q: %w", s, err)
+		}
+		p.Delays = append(p.Delays, d)
+	}
+	return p, nil
+}
+
+func parseDelay(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("delay %q must be positive", s)
+	}
+	return d, nil
+}
+
+// Delay returns how long to wait before retrying after the given attempt
+// (0 for the first failure).
+func (p Policy) Delay(attempt int) time.Duration {
+	attempt = max(attempt, 0)
+	ceiling := p.Max
+	if ceiling == 0 {
+		ceiling = maxDelay
+	}
+	var d time.Duration
+	switch p.Kind {
+	case Fixed:
+		d = p.Base
+	case Linear:
+		d = p.Base * time.Duration(attempt+1)
+		if d/time.Duration(attempt+1) != p.Base { // overflow
+			d = ceiling
+		}
+	case Exponential:
+		d = ceiling
+		if attempt < 62 {
+			if e := p.Base << attempt; e > 0 && e>>attempt == p.Base {
+				d = e
+			}
+		}
+	case Schedule:
+		d = p.Delays[min(attempt, len(p.Delays)-1)]
+	}
+	d = min(d, ceiling)
+	switch p.Jitter {
+	case JitterFull:
+		d = rand.N(d + 1)
+	case JitterEqual:
+		d = d/2 + rand.N(d/2+1)
+	}
+	return d
+}
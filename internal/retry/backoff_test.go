@@ -0,0 +1,151 @@
+package retry
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Policy
+	}{
+		{"fixed:10s", Policy{Kind: Fixed, Base: 10 * time.Second, Max: defaultMax, Jitter: JitterNone}},
+		{"linear:30s,max=10m", Policy{Kind: Linear, Base: 30 * time.Second, Max: 10 * time.Minute, Jitter: JitterNone}},
+		{"exponential", Policy{Kind: Exponential, Base: defaultBase, Max: defaultMax, Jitter: JitterNone}},
+		{" exponential:5s, max=1h, jitter=full ", Policy{Kind: Exponential, Base: 5 * time.Second, Max: time.Hour, Jitter: JitterFull}},
+		{"exponential:1s,jitter=equal", Policy{Kind: Exponential, Base: time.Second, Max: defaultMax, Jitter: JitterEqual}},
+		// the default cap only applies to bases below it
+		{"fixed:48h", Policy{Kind: Fixed, Base: 48 * time.Hour, Jitter: JitterNone}},
+		{"linear:25h", Policy{Kind: Linear, Base: 25 * time.Hour, Jitter: JitterNone}},
+		{"fixed:48h,max=72h", Policy{Kind: Fixed, Base: 48 * time.Hour, Max: 72 * time.Hour, Jitter: JitterNone}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Kind != tt.want.Kind || got.Base != tt.want.Base || got.Max != tt.want.Max || got.Jitter != tt.want.Jitter {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	p, err := Parse("10s, 1m,5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Kind != Schedule || len(p.Delays) != 3 || p.Delays[1] != time.Minute {
+		t.Errorf("Parse(schedule) = %+v", p)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "empty backoff policy"},
+		{"fixed", "needs a delay"},
+		{"linear", "needs a delay"},
+		{"fixed:soon", "invalid duration"},
+		{"fixed:-1s", "must be positive"},
+		{"fixed:0s", "must be positive"},
+		{"exponential:1s,2s", `unexpected "2s"`},
+		{"exponential:1s,jitter=some", `unknown jitter "some"`},
+		{"exponential:1s,cap=1m", `unknown backoff option "cap"`},
+		{"exponential:1m,max=30s", "below base"},
+		{"fixed:48h,max=24h", "below base"},
+		{"10s,,1m", "invalid backoff policy"},
+		{"10s,later", "invalid backoff policy"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want one containing %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []time.Duration // for attempts 0, 1, 2, ...
+	}{
+		{"fixed:10s", []time.Duration{10 * time.Second, 10 * time.Second, 10 * time.Second}},
+		{"fixed:48h", []time.Duration{48 * time.Hour, 48 * time.Hour}},
+		{"linear:30s", []time.Duration{30 * time.Second, time.Minute, 90 * time.Second}},
+		{"linear:1m,max=150s", []time.Duration{time.Minute, 2 * time.Minute, 150 * time.Second, 150 * time.Second}},
+		{"exponential:5s", []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second}},
+		{"exponential:1m,max=3m", []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}},
+		{"10s,1m,5m", []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute, 5 * time.Minute}},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.policy)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.policy, err)
+		}
+		for attempt, want := range tt.want {
+			if got := p.Delay(attempt); got != want {
+				t.Errorf("%s: Delay(%d) = %v, want %v", tt.policy, attempt, got, want)
+			}
+		}
+	}
+}
+
+// Delays that would overflow time.Duration stop at the cap.
+func TestDelayOverflow(t *testing.T) {
+	tests := []struct {
+		policy  string
+		attempt int
+		want    time.Duration
+	}{
+		{"exponential:30s", 62, defaultMax},
+		{"exponential:30s", 1000, defaultMax},
+		{"exponential:1h,max=100000h", 40, 100000 * time.Hour},
+		{"exponential:48h", 100, time.Duration(math.MaxInt64)},
+		{"linear:48h", math.MaxInt32, time.Duration(math.MaxInt64)},
+		{"linear:1s", math.MaxInt32, defaultMax},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.policy)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.policy, err)
+		}
+		if got := p.Delay(tt.attempt); got != tt.want {
+			t.Errorf("%s: Delay(%d) = %v, want %v", tt.policy, tt.attempt, got, tt.want)
+		}
+	}
+	p, _ := Parse("exponential:30s")
+	if got := p.Delay(-1); got != 30*time.Second {
+		t.Errorf("Delay(-1) = %v, want the first delay", got)
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	tests := []struct {
+		policy   string
+		min, max time.Duration
+	}{
+		{"exponential:10s,jitter=full", 0, 40 * time.Second},
+		{"exponential:10s,jitter=equal", 20 * time.Second, 40 * time.Second},
+		{"exponential:10s,max=30s,jitter=equal", 15 * time.Second, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.policy)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.policy, err)
+		}
+		lo, hi := tt.max, tt.min
+		for range 1000 {
+			d := p.Delay(2)
+			if d < tt.min || d > tt.max {
+				t.Fatalf("%s: Delay(2) = %v, outside [%v, %v]", tt.policy, d, tt.min, tt.max)
+			}
+			lo, hi = min(lo, d), max(hi, d)
+		}
+		// spread over the range, not stuck at one end
+		if span := tt.max - tt.min; hi-lo < span/2 {
+			t.Errorf("%s: 1000 delays only spanned [%v, %v]", tt.policy, lo, hi)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/queue"
+)
+
+// ReadyChannel is the NOTIFY channel the outbox trigger signals, with the
+// tenant ID as payload, whenever a job is made ready.
+const ReadyChannel = "enq_ready"
+
+// ClaimAt is the claim_at stored for a job that becomes ready at runAt: the
+// time queue.ReadyScore puts it at, which Claim orders by.
+func ClaimAt(runAt time.Time, priority int, bound time.Duration) time.Time {
+	return time.UnixMilli(int64(queue.ReadyScore(runAt, priority, bound))).UTC()
+}
+
+// claimable reports whether a job of the Postgres-only queue mode may be
+// claimed: f lets its type through and its limit, if any, has budget left.
+func claimable(typ string, f queue.Filter, budget map[string]int) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			found = found || t == typ
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Skip[typ] {
+		return false
+	}
+	if l, ok := f.Limits[typ]; ok && budget[l.Key] <= 0 {
+		return false
+	}
+	return true
+}
+
+// rateBudget is how many more leases each rate limit key allows in the
+// current one-second window, given the leases per type in the last second.
+func rateBudget(limits map[string]queue.RateLimit, recent map[string]int) map[string]int {
+	budget := map[string]int{}
+	for _, l := range limits {
+		budget[l.Key] = l.QPS
+	}
+	for typ, l := range limits {
+		budget[l.Key] -= recent[typ]
+	}
+	return budget
+}
+
+func (s *Store) Claim(ctx context.Context, tenantID, workerID string, f queue.Filter, caps ConcurrencyCaps, count int) ([]domain.Job, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// caps and rate limits are checked against counts that other claims
+	// change, so hold the tenant's lease lock while deciding
+	leasedNow := map[string]int{}
+	budget := map[string]int{}
+	if caps.Any() || len(f.Limits) > 0 {
+		if err := LockTenantLeases(ctx, tx, tenantID); err != nil {
+			return nil, err
+		}
+	}
+	if caps.Any() {
+		if leasedNow, err = LeasedCounts(ctx, tx, tenantID); err != nil {
+			return nil, err
+		}
+		if rem := caps.Remaining(leasedNow); rem >= 0 && rem < count {
+			count = rem
+		}
+	}
+	if len(f.Limits) > 0 {
+		recent := map[string]int{}
+		rows, err := tx.Query(ctx,
+			`select j.type, count(*)
+			   from job_events e join jobs j on j.id = e.job_id
+			  where e.tenant_id = $1 and e.event = 'leased' and e.created_at > now() - interval '1 second'
+			  group by j.type`, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var typ string
+			var n int
+			if err := rows.Scan(&typ, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			recent[typ] = n
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		budget = rateBudget(f.Limits, recent)
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+
+	// types that can't take a job this round are left out of the scan
+	skip := []string{}
+	for typ, full := range f.Skip {
+		if full {
+			skip = append(skip, typ)
+		}
+	}
+	for typ := range caps.Types {
+		if caps.Full(leasedNow, typ) {
+			skip = append(skip, typ)
+		}
+	}
+	for typ := range f.Limits {
+		if !claimable(typ, f, budget) {
+			skip = append(skip, typ)
+		}
+	}
+	var types []string
+	if len(f.Types) > 0 {
+		types = f.Types
+	}
+
+	// same order as the Redis ready sets (claim_at is queue.ReadyScore), so
+	// the jobs_claim index serves it; skip locked: rows another claim is
+	// taking are passed over, not waited on
+	rows, err := tx.Query(ctx,
+		`select id::text, type from jobs
+		  where tenant_id = $1 and status in ('queued', 'failed_temp') and run_at <= now()
+		    and ($2::text[] is null or type = any($2)) and type <> all($3)
+		  order by claim_at, id
+		  limit $4
+		    for update skip locked`,
+		tenantID, types, skip, count)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id, typ string
+		if err := rows.Scan(&id, &typ); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// a batch can use up a cap or limit part way through
+		if caps.Any() && caps.Full(leasedNow, typ) {
+			continue
+		}
+		if !claimable(typ, f, budget) {
+			continue
+		}
+		if l, ok := f.Limits[typ]; ok {
+			budget[l.Key]--
+		}
+		leasedNow[typ]++
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	leased, err := leaseJobs(ctx, tx, tenantID, workerID, ids)
+	if err != nil {
+		return nil, err
+	}
+	return leased, tx.Commit(ctx)
+}
+
+func (s *Store) Ready(tenantID string) <-chan struct{} { return s.ready.wait(tenantID) }
+
+// Listen turns notifications on ReadyChannel into Ready wakeups until ctx is
+// done, reconnecting on errors. Run it in the background of an API replica
+// that claims from Postgres.
+func (s *Store) Listen(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := s.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Println("listen:", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+func (s *Store) listen(ctx context.Context) error {
+	pc, err := s.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// the connection stays subscribed, so keep it out of the pool
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "listen "+ReadyChannel); err != nil {
+		return err
+	}
+	// anything made ready while nobody was listening
+	s.ready.wakeAll()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		s.ready.wake(n.Payload)
+	}
+}
+
+// waker hands out per-tenant channels that are closed on the tenant's next
+// wakeup.
+type waker struct {
+	mu    sync.Mutex
+	chans map[string]chan struct{}
+}
+
+func newWaker() *waker { return &waker{chans: map[string]chan struct{}{}} }
+
+func (w *waker) wait(tenantID string) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ch, ok := w.chans[tenantID]
+	if !ok {
+		ch = make(chan struct{})
+		w.chans[tenantID] = ch
+	}
+	return ch
+}
+
+func (w *waker) wake(tenantID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ch, ok := w.chans[tenantID]; ok {
+		close(ch)
+		delete(w.chans, tenantID)
+	}
+}
+
+func (w *waker) wakeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for t, ch := range w.chans {
+		close(ch)
+		delete(w.chans, t)
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Querier is satisfied by *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// ConcurrencyCaps are the max_concurrency settings that apply to a tenant's
+// leased jobs. Leased counts are always derived from jobs.status, so a slot
+// frees itself on complete, fail, dead-letter or lease-expiry requeue.
+type ConcurrencyCaps struct {
+	Tenant *int           // all leased jobs of the tenant
+	Types  map[string]int // leased jobs per type
+}
+
+// Any reports whether any cap is configured.
+func (c ConcurrencyCaps) Any() bool { return c.Tenant != nil || len(c.Types) > 0 }
+
+// Full reports whether typ (or the tenant as a whole) has no free slot.
+func (c ConcurrencyCaps) Full(leased map[string]int, typ string) bool {
+	if c.Tenant != nil {
+		total := 0
+		for _, n := range leased {
+			total += n
+		}
+		if total >= *c.Tenant {
+			return true
+		}
+	}
+	if limit, ok := c.Types[typ]; ok && leased[typ] >= limit {
+		return true
+	}
+	return false
+}
+
+// Remaining is how many more jobs the tenant may lease, or -1 if uncapped.
+func (c ConcurrencyCaps) Remaining(leased map[string]int) int {
+	if c.Tenant == nil {
+		return -1
+	}
+	total := 0
+	for _, n := range leased {
+		total += n
+	}
+	return max(*c.Tenant-total, 0)
+}
+
+func (s *Store) ConcurrencyCaps(ctx context.Context, tenantID string) (ConcurrencyCaps, error) {
+	caps := ConcurrencyCaps{Types: map[string]int{}}
+	err := s.db.QueryRow(ctx, `select max_concurrency from tenants where id = $1`, tenantID).Scan(&caps.Tenant)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return caps, err
+	}
+	rows, err := s.db.Query(ctx, `select type, max_concurrency from job_types
+where tenant_id = $1 and max_concurrency is not null`, tenantID)
+	if err != nil {
+		return caps, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var typ string
+		var n int
+		if err := rows.Scan(&typ, &n); err != nil {
+			return caps, err
+		}
+		caps.Types[typ] = n
+	}
+	return caps, rows.Err()
+}
+
+// LeasedCounts returns the number of leased jobs per type. For an exact
+// count that other lease calls can't race, run it in a tx that holds
+// LockTenantLeases.
+func LeasedCounts(ctx context.Context, db Querier, tenantID string) (map[string]int, error) {
+	rows, err := db.Query(ctx, `select type, count(*) from jobs
+where tenant_id = $1 and status = 'leased' group by type`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var typ string
+		var n int
+		if err := rows.Scan(&typ, &n); err != nil {
+			return nil, err
+		}
+		out[typ] = n
+	}
+	return out, rows.Err()
+}
+
+// LockTenantLeases serializes capped lease transactions of one tenant across
+// API replicas until the tx ends.
+func LockTenantLeases(ctx context.Context, tx Execer, tenantID string) error {
+	_, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtextextended('lease/' || $1, 0))`, tenantID)
+	return err
+}
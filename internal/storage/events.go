@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/SirClappington/enq/internal/domain"
+)
+
+// Execer is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx, so events can
+// be written inside the caller's transaction.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// RecordEvent appends a lifecycle event for a job. Call it with the same tx
+// that performs the status change so the trail never disagrees with jobs.
+func RecordEvent(ctx context.Context, db Execer, tenantID, jobID string, ev domain.Event, meta map[string]any) error {
+	var raw []byte
+	if meta != nil {
+		var err error
+		if raw, err = json.Marshal(meta); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(ctx,
+		`insert into job_events(job_id, tenant_id, event, metadata) values ($1, $2, $3, $4)`,
+		jobID, tenantID, string(ev), raw)
+	return err
+}
@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/SirClappington/enq/internal/domain"
+)
+
+var _ Repository = (*Store)(nil)
+
+func (s *Store) LeasedCounts(ctx context.Context, tenantID string) (map[string]int, error) {
+	return LeasedCounts(ctx, s.db, tenantID)
+}
+
+func (s *Store) Lease(ctx context.Context, tenantID, workerID string, ids []string, caps ConcurrencyCaps) ([]domain.Job, []domain.Job, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// re-check caps under a per-tenant lock so replicas can't overshoot
+	var deferred []domain.Job
+	if caps.Any() {
+		if err := LockTenantLeases(ctx, tx, tenantID); err != nil {
+			return nil, nil, err
+		}
+		leasedNow, err := LeasedCounts(ctx, tx, tenantID)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows, err := tx.Query(ctx,
+			`select id::text, type, priority, run_at from jobs where id = any($1::uuid[]) and tenant_id=$2`,
+			ids, tenantID)
+		if err != nil {
+			return nil, nil, err
+		}
+		popped := make(map[string]domain.Job, len(ids))
+		for rows.Next() {
+			j := domain.Job{TenantID: tenantID}
+			if err := rows.Scan(&j.ID, &j.Type, &j.Priority, &j.RunAt); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			popped[j.ID] = j
+		}
+		rows.Close()
+		allowed := make([]string, 0, len(ids))
+		for _, id := range ids {
+			j, ok := popped[id]
+			if !ok {
+				continue
+			}
+			if caps.Full(leasedNow, j.Type) {
+				// it was popped, so the queue has to be handed it again
+				if err := WriteOutbox(ctx, tx, tenantID, j.ID); err != nil {
+					return nil, nil, err
+				}
+				deferred = append(deferred, j)
+				continue
+			}
+			leasedNow[j.Type]++
+			allowed = append(allowed, id)
+		}
+		ids = allowed
+	}
+
+	leased, err := leaseJobs(ctx, tx, tenantID, workerID, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return leased, deferred, tx.Commit(ctx)
+}
+
+// leaseJobs leases ids to workerID inside tx and returns them in ids order.
+// Ids that are no longer queued or awaiting retry (completed, re-leased,
+// ...) are dropped.
+func leaseJobs(ctx context.Context, tx pgx.Tx, tenantID, workerID string, ids []string) ([]domain.Job, error) {
+	rows, err := tx.Query(ctx,
+		`update jobs
+		    set status='leased', leased_by=$3,
+		        lease_expires_at=now() + visibility_timeout_sec * interval '1 second',
+		        lease_version=lease_version + 1,
+		        updated_at=now()
+		  where id = any($1::uuid[]) and tenant_id=$2 and status in ('queued','failed_temp')
+		  returning id::text, type, payload, priority, run_at, attempt, max_attempts,
+		            visibility_timeout_sec, lease_expires_at, lease_version`,
+		ids, tenantID, workerID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]domain.Job, len(ids))
+	for rows.Next() {
+		j := domain.Job{TenantID: tenantID, Status: domain.Leased, LeasedBy: &workerID}
+		if err := rows.Scan(&j.ID, &j.Type, &j.Payload, &j.Priority, &j.RunAt, &j.Attempt, &j.MaxAttempts,
+			&j.VisibilityTimeoutSec, &j.LeaseExpiresAt, &j.LeaseVersion); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byID[j.ID] = j
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	leased := make([]domain.Job, 0, len(byID))
+	for _, id := range ids {
+		j, ok := byID[id]
+		if !ok {
+			continue
+		}
+		if err := RecordEvent(ctx, tx, tenantID, j.ID, domain.EventLeased, map[string]any{
+			"workerId": workerID, "attempt": j.Attempt, "leaseExpiresAt": j.LeaseExpiresAt,
+			"leaseVersion": j.LeaseVersion,
+		}); err != nil {
+			return nil, err
+		}
+		leased = append(leased, j)
+	}
+	return leased, nil
+}
+
+func (s *Store) Extend(ctx context.Context, tenantID, jobID, workerID string, leaseVersion int64, by time.Duration) (time.Time, error) {
+	if uuid.Validate(jobID) != nil {
+		return time.Time{}, ErrJobNotFound
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var attempt int
+	var expires time.Time
+	err = tx.QueryRow(ctx,
+		`update jobs
+		    set lease_expires_at = now() + $2 * interval '1 second',
+		        updated_at = now()
+		  where id = $1 and tenant_id=$3 and status='leased' and lease_version=$4
+		  returning attempt, lease_expires_at`,
+		jobID, int(by/time.Second), tenantID, leaseVersion).Scan(&attempt, &expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, s.ackMiss(ctx, tenantID, jobID)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := RecordEvent(ctx, tx, tenantID, jobID, domain.EventExtended, map[string]any{
+		"workerId": workerID, "attempt": attempt, "leaseExpiresAt": expires,
+	}); err != nil {
+		return time.Time{}, err
+	}
+	return expires, tx.Commit(ctx)
+}
+
+func (s *Store) Complete(ctx context.Context, tenantID, jobID, workerID string, leaseVersion int64) error {
+	if uuid.Validate(jobID) != nil {
+		return ErrJobNotFound
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var attempt int
+	err = tx.QueryRow(ctx,
+		`update jobs
+		    set status='succeeded', updated_at=now()
+		  where id=$1 and tenant_id=$2 and status='leased' and lease_version=$3
+		  returning attempt`,
+		jobID, tenantID, leaseVersion).Scan(&attempt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.ackMiss(ctx, tenantID, jobID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := RecordEvent(ctx, tx, tenantID, jobID, domain.EventCompleted, map[string]any{
+		"workerId": workerID, "attempt": attempt,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Store) Fail(ctx context.Context, f FailParams) (*domain.Job, error) {
+	if uuid.Validate(f.JobID) != nil {
+		return nil, ErrJobNotFound
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	j := domain.Job{ID: f.JobID, TenantID: f.TenantID}
+	err = tx.QueryRow(ctx,
+		`select type, priority, run_at, attempt, max_attempts, backoff_policy, status::text, lease_version
+		   from jobs where id=$1 and tenant_id=$2
+		    for update`,
+		f.JobID, f.TenantID).Scan(&j.Type, &j.Priority, &j.RunAt, &j.Attempt, &j.MaxAttempts,
+		&j.BackoffPolicy, &j.Status, &j.LeaseVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if j.Status != domain.Leased || j.LeaseVersion != f.LeaseVersion {
+		return nil, ackMiss(j.Status)
+	}
+	j.Error = &f.Error
+
+	switch {
+	case f.Retryable && j.Attempt+1 < j.MaxAttempts:
+		next := time.Now().UTC().Add(backoffDelay(j.ID, j.BackoffPolicy, j.Attempt))
+		if _, err := tx.Exec(ctx,
+			`update jobs
+			    set attempt=attempt+1, status='failed_temp', error=$3,
+			        run_at=$4, claim_at=$4 - (run_at - claim_at), updated_at=now()
+			  where id=$1 and tenant_id=$2`,
+			j.ID, j.TenantID, f.Error, next); err != nil {
+			return nil, err
+		}
+		if err := RecordEvent(ctx, tx, j.TenantID, j.ID, domain.EventRetried, map[string]any{
+			"workerId": f.WorkerID, "attempt": j.Attempt, "error": f.Error, "nextRunAt": next,
+		}); err != nil {
+			return nil, err
+		}
+		if err := WriteOutbox(ctx, tx, j.TenantID, j.ID); err != nil {
+			return nil, err
+		}
+		j.Status, j.RunAt = domain.FailedTemp, next
+		j.Attempt++
+
+	case f.Retryable:
+		// out of attempts: park it in the DLQ for inspection / replay
+		reason := fmt.Sprintf("max attempts (%d) exhausted: %s", j.MaxAttempts, f.Error)
+		if _, err := tx.Exec(ctx,
+			`update jobs
+			    set status='dead_lettered', error=$3, leased_by=null, lease_expires_at=null, updated_at=now()
+			  where id=$1 and tenant_id=$2`,
+			j.ID, j.TenantID, f.Error); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx,
+			`insert into dead_letters(job_id, tenant_id, reason) values ($1, $2, $3)
+			 on conflict (job_id) do update set reason = excluded.reason, parked_at = now()`,
+			j.ID, j.TenantID, reason); err != nil {
+			return nil, err
+		}
+		if err := RecordEvent(ctx, tx, j.TenantID, j.ID, domain.EventDeadLettered, map[string]any{
+			"workerId": f.WorkerID, "attempt": j.Attempt, "error": f.Error, "reason": reason,
+		}); err != nil {
+			return nil, err
+		}
+		j.Status = domain.DeadLettered
+
+	default:
+		if _, err := tx.Exec(ctx,
+			`update jobs
+			    set status='failed_perm', error=$3, updated_at=now()
+			  where id=$1 and tenant_id=$2`,
+			j.ID, j.TenantID, f.Error); err != nil {
+			return nil, err
+		}
+		if err := RecordEvent(ctx, tx, j.TenantID, j.ID, domain.EventFailed, map[string]any{
+			"workerId": f.WorkerID, "attempt": j.Attempt, "error": f.Error,
+		}); err != nil {
+			return nil, err
+		}
+		j.Status = domain.FailedPerm
+	}
+	return &j, tx.Commit(ctx)
+}
+
+// ackMiss explains why an ack on jobID matched no row.
+func (s *Store) ackMiss(ctx context.Context, tenantID, jobID string) error {
+	var status domain.Status
+	err := s.db.QueryRow(ctx,
+		`select status::text from jobs where id = $1 and tenant_id = $2`, jobID, tenantID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ackMiss(status)
+}
+
+func (s *Store) ListJobs(ctx context.Context, tenantID string, limit int) ([]domain.Job, error) {
+	rows, err := s.db.Query(ctx,
+		`select id::text, type, status::text, attempt, run_at, payload
+		   from jobs
+		  where tenant_id = $1
+		  order by created_at desc
+		  limit $2`, tenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.Job
+	for rows.Next() {
+		j := domain.Job{TenantID: tenantID}
+		if err := rows.Scan(&j.ID, &j.Type, &j.Status, &j.Attempt, &j.RunAt, &j.Payload); err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) JobEvents(ctx context.Context, tenantID, jobID string) ([]domain.JobEvent, error) {
+	if uuid.Validate(jobID) != nil {
+		return nil, ErrJobNotFound
+	}
+	var exists bool
+	if err := s.db.QueryRow(ctx,
+		`select exists(select 1 from jobs where id = $1 and tenant_id = $2)`,
+		jobID, tenantID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+
+	rows, err := s.db.Query(ctx,
+		`select id, event, coalesce(metadata, '{}'::jsonb), created_at
+		   from job_events
+		  where job_id = $1 and tenant_id = $2
+		  order by id`, jobID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.JobEvent
+	for rows.Next() {
+		e := domain.JobEvent{JobID: jobID, TenantID: tenantID}
+		if err := rows.Scan(&e.ID, &e.Event, &e.Metadata, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) Tenants(ctx context.Context) ([]string, error) {
+	rows, err := s.db.Query(ctx, `select id from tenants`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) RequeueExpired(ctx context.Context, tenantID string, limit int) ([]domain.Job, error) {
+	// requeue, record the lease_expired events and queue the pushes in one
+	// statement; the expired CTE captures each lease before it is cleared
+	rows, err := s.db.Query(ctx,
+		`with expired as (
+		   select id, tenant_id, type, priority, run_at, leased_by, lease_expires_at, attempt
+		     from jobs
+		    where tenant_id = $1 and status = 'leased' and lease_expires_at < now()
+		    order by lease_expires_at
+		    limit $2
+		    for update skip locked),
+		 requeued as (
+		   update jobs j
+		      set status = 'queued',
+		          leased_by = null,
+		          lease_expires_at = null,
+		          updated_at = now()
+		     from expired
+		    where j.id = expired.id),
+		 events as (
+		   insert into job_events(job_id, tenant_id, event, metadata)
+		   select id, tenant_id, $3, jsonb_build_object(
+		            'workerId', leased_by, 'attempt', attempt, 'leaseExpiresAt', lease_expires_at)
+		     from expired),
+		 pushes as (
+		   insert into outbox(tenant_id, job_id)
+		   select tenant_id, id from expired)
+		 select id::text, type, priority, run_at from expired`,
+		tenantID, limit, string(domain.EventLeaseExpired))
+	if err != nil {
+		return nil, err
+	}
+	return scanReady(rows, tenantID)
+}
+
+func (s *Store) Reconcile(ctx context.Context, tenantID, after string, limit int) ([]domain.Job, error) {
+	rows, err := s.db.Query(ctx,
+		`select id::text, type, priority, run_at from jobs j
+		  where tenant_id = $1 and status in ('queued', 'failed_temp')
+		    and id > coalesce(nullif($2, '')::uuid, '00000000-0000-0000-0000-000000000000')
+		    and updated_at < now() - make_interval(secs => $3)
+		    and not exists (
+		      select 1 from outbox o
+		       where o.job_id = j.id
+		         and (o.sent_at is null or o.sent_at > now() - make_interval(secs => $3)))
+		  order by id limit $4`, tenantID, after, ReconcileGrace.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanReady(rows, tenantID)
+}
+
+// scanReady reads (id, type, priority, run_at) rows of queued jobs.
+func scanReady(rows pgx.Rows, tenantID string) ([]domain.Job, error) {
+	defer rows.Close()
+	var out []domain.Job
+	for rows.Next() {
+		j := domain.Job{TenantID: tenantID, Status: domain.Queued}
+		if err := rows.Scan(&j.ID, &j.Type, &j.Priority, &j.RunAt); err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
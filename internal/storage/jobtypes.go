@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/SirClappington/enq/internal/domain"
+)
+
+// JobType returns the tenant's registered settings for typ, or nil if the
+// type was never registered.
+func (s *Store) JobType(ctx context.Context, tenantID, typ string) (*domain.JobType, error) {
+	return LookupJobType(ctx, s.db, tenantID, typ)
+}
+
+// LookupJobType is JobType on db, e.g. a tx that creates jobs of the type.
+func LookupJobType(ctx context.Context, db Querier, tenantID, typ string) (*domain.JobType, error) {
+	rows, err := db.Query(ctx, `select id, max_attempts, backoff_policy, visibility_timeout_sec,
+rate_limit_key, rate_limit_qps, max_concurrency, schema
+from job_types where tenant_id = $1 and type = $2`, tenantID, typ)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	jt := domain.JobType{TenantID: tenantID, Type: typ}
+	if err := rows.Scan(&jt.ID, &jt.MaxAttempts, &jt.BackoffPolicy, &jt.VisibilityTimeoutSec,
+		&jt.RateLimitKey, &jt.RateLimitQPS, &jt.MaxConcurrency, &jt.Schema); err != nil {
+		return nil, err
+	}
+	return &jt, nil
+}
+
+// RateLimitedTypes returns the tenant's job types that have a rate limit;
+// only Type, RateLimitKey and RateLimitQPS are set.
+func (s *Store) RateLimitedTypes(ctx context.Context, tenantID string) ([]domain.JobType, error) {
+	rows, err := s.db.Query(ctx, `select type, rate_limit_key, rate_limit_qps
+from job_types where tenant_id = $1 and rate_limit_qps > 0`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []domain.JobType
+	for rows.Next() {
+		jt := domain.JobType{TenantID: tenantID}
+		if err := rows.Scan(&jt.Type, &jt.RateLimitKey, &jt.RateLimitQPS); err != nil {
+			return nil, err
+		}
+		out = append(out, jt)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,428 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/queue"
+)
+
+// Memory is an in-process Repository for tests and local demos. It keeps
+// the same state machine as Store but loses everything on exit.
+type Memory struct {
+	mu       sync.Mutex
+	jobs     map[string]*domain.Job
+	seq      map[string]int64 // insertion order, for created_at ordering
+	events   []domain.JobEvent
+	jobTypes map[string]map[string]domain.JobType // tenant -> type
+	tenants  map[string]*int                      // tenant -> max_concurrency
+	outbox   []string                             // job IDs waiting to be pushed
+	ready    *waker
+	next     int64
+	now      func() time.Time
+
+	starvationBound time.Duration // Claim's priority head start, as in queue.ReadyScore
+}
+
+var _ Repository = (*Memory)(nil)
+
+func NewMemory(starvationBound time.Duration) *Memory {
+	return &Memory{
+		starvationBound: starvationBound,
+		jobs:            map[string]*domain.Job{},
+		seq:             map[string]int64{},
+		jobTypes:        map[string]map[string]domain.JobType{},
+		tenants:         map[string]*int{},
+		ready:           newWaker(),
+		now:             func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// AddTenant registers a tenant with an optional max_concurrency.
+func (m *Memory) AddTenant(id string, maxConcurrency *int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tenants[id] = maxConcurrency
+}
+
+// PutJobType registers or replaces a job type.
+func (m *Memory) PutJobType(jt domain.JobType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobTypes[jt.TenantID] == nil {
+		m.jobTypes[jt.TenantID] = map[string]domain.JobType{}
+	}
+	m.jobTypes[jt.TenantID][jt.Type] = jt
+}
+
+// push queues j for the outbox relay and wakes claims waiting on its tenant.
+func (m *Memory) push(j *domain.Job) {
+	m.outbox = append(m.outbox, j.ID)
+	m.ready.wake(j.TenantID)
+}
+
+func (m *Memory) record(j *domain.Job, ev domain.Event, meta map[string]any) {
+	raw, _ := json.Marshal(meta)
+	m.next++
+	m.events = append(m.events, domain.JobEvent{
+		ID: m.next, JobID: j.ID, TenantID: j.TenantID, Event: ev, Metadata: raw, CreatedAt: m.now(),
+	})
+}
+
+func (m *Memory) job(tenantID, jobID string) *domain.Job {
+	j, ok := m.jobs[jobID]
+	if !ok || j.TenantID != tenantID {
+		return nil
+	}
+	return j
+}
+
+func (m *Memory) InsertJob(ctx context.Context, p *InsertJobParams) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if p.DedupeKey != nil {
+		var newest *domain.Job
+		for _, j := range m.jobs {
+			if j.TenantID != p.TenantID || j.DedupeKey == nil || *j.DedupeKey != *p.DedupeKey {
+				continue
+			}
+			if j.DedupeTTL != nil && !j.CreatedAt.After(now.Add(-time.Duration(*j.DedupeTTL)*time.Second)) {
+				continue
+			}
+			if newest == nil || m.seq[j.ID] > m.seq[newest.ID] {
+				newest = j
+			}
+		}
+		if newest != nil {
+			return newest.ID, true, nil
+		}
+	}
+
+	j := &domain.Job{
+		ID: uuid.NewString(), TenantID: p.TenantID, Type: p.Type, Payload: p.Payload,
+		Priority: p.Priority, RunAt: p.RunAt, DedupeKey: p.DedupeKey, DedupeTTL: p.DedupeTTL,
+		MaxAttempts: p.MaxAttempts, BackoffPolicy: p.BackoffPolicy,
+		VisibilityTimeoutSec: p.VisibilityTimeoutSec, Status: domain.Queued,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	if _, ok := m.tenants[p.TenantID]; !ok {
+		m.tenants[p.TenantID] = nil
+	}
+	m.next++
+	m.jobs[j.ID], m.seq[j.ID] = j, m.next
+	m.record(j, domain.EventEnqueued, map[string]any{
+		"runAt": p.RunAt, "priority": p.Priority, "maxAttempts": p.MaxAttempts,
+	})
+	m.push(j)
+	return j.ID, false, nil
+}
+
+func (m *Memory) JobType(ctx context.Context, tenantID, typ string) (*domain.JobType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jt, ok := m.jobTypes[tenantID][typ]
+	if !ok {
+		return nil, nil
+	}
+	return &jt, nil
+}
+
+func (m *Memory) RateLimitedTypes(ctx context.Context, tenantID string) ([]domain.JobType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.JobType
+	for _, jt := range m.jobTypes[tenantID] {
+		if jt.RateLimitQPS != nil && *jt.RateLimitQPS > 0 {
+			out = append(out, jt)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) ConcurrencyCaps(ctx context.Context, tenantID string) (ConcurrencyCaps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	caps := ConcurrencyCaps{Tenant: m.tenants[tenantID], Types: map[string]int{}}
+	for _, jt := range m.jobTypes[tenantID] {
+		if jt.MaxConcurrency != nil {
+			caps.Types[jt.Type] = *jt.MaxConcurrency
+		}
+	}
+	return caps, nil
+}
+
+func (m *Memory) LeasedCounts(ctx context.Context, tenantID string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leasedCounts(tenantID), nil
+}
+
+func (m *Memory) leasedCounts(tenantID string) map[string]int {
+	out := map[string]int{}
+	for _, j := range m.jobs {
+		if j.TenantID == tenantID && j.Status == domain.Leased {
+			out[j.Type]++
+		}
+	}
+	return out
+}
+
+func (m *Memory) Lease(ctx context.Context, tenantID, workerID string, ids []string, caps ConcurrencyCaps) ([]domain.Job, []domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	leasedNow := m.leasedCounts(tenantID)
+	var leased, deferred []domain.Job
+	for _, id := range ids {
+		j := m.job(tenantID, id)
+		if j == nil || (j.Status != domain.Queued && j.Status != domain.FailedTemp) {
+			continue
+		}
+		if caps.Any() && caps.Full(leasedNow, j.Type) {
+			m.push(j)
+			deferred = append(deferred, *j)
+			continue
+		}
+		leasedNow[j.Type]++
+		leased = append(leased, m.lease(j, workerID, now))
+	}
+	return leased, deferred, nil
+}
+
+// lease hands j to workerID and returns a copy.
+func (m *Memory) lease(j *domain.Job, workerID string, now time.Time) domain.Job {
+	exp := now.Add(time.Duration(j.VisibilityTimeoutSec) * time.Second)
+	worker := workerID
+	j.Status, j.LeasedBy, j.LeaseExpiresAt, j.UpdatedAt = domain.Leased, &worker, &exp, now
+	j.LeaseVersion++
+	m.record(j, domain.EventLeased, map[string]any{
+		"workerId": workerID, "attempt": j.Attempt, "leaseExpiresAt": exp, "leaseVersion": j.LeaseVersion,
+	})
+	return *j
+}
+
+func (m *Memory) Claim(ctx context.Context, tenantID, workerID string, f queue.Filter, caps ConcurrencyCaps, count int) ([]domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	leasedNow := m.leasedCounts(tenantID)
+	recent := map[string]int{}
+	for _, e := range m.events {
+		if e.TenantID == tenantID && e.Event == domain.EventLeased && e.CreatedAt.After(now.Add(-time.Second)) {
+			recent[m.jobs[e.JobID].Type]++
+		}
+	}
+	budget := rateBudget(f.Limits, recent)
+
+	due := m.filter(tenantID, func(j *domain.Job) bool {
+		return (j.Status == domain.Queued || j.Status == domain.FailedTemp) && !j.RunAt.After(now)
+	})
+	score := func(j domain.Job) float64 { return queue.ReadyScore(j.RunAt, j.Priority, m.starvationBound) }
+	sort.Slice(due, func(a, b int) bool {
+		if sa, sb := score(due[a]), score(due[b]); sa != sb {
+			return sa < sb
+		}
+		return due[a].ID < due[b].ID
+	})
+	var out []domain.Job
+	for _, c := range due {
+		if len(out) == count {
+			break
+		}
+		if (caps.Any() && caps.Full(leasedNow, c.Type)) || !claimable(c.Type, f, budget) {
+			continue
+		}
+		if l, ok := f.Limits[c.Type]; ok {
+			budget[l.Key]--
+		}
+		leasedNow[c.Type]++
+		out = append(out, m.lease(m.jobs[c.ID], workerID, now))
+	}
+	return out, nil
+}
+
+func (m *Memory) Ready(tenantID string) <-chan struct{} { return m.ready.wait(tenantID) }
+
+// fenced returns the job if it is still leased at leaseVersion.
+func (m *Memory) fenced(tenantID, jobID string, leaseVersion int64) (*domain.Job, error) {
+	j := m.job(tenantID, jobID)
+	if j == nil {
+		return nil, ErrJobNotFound
+	}
+	if j.Status != domain.Leased || j.LeaseVersion != leaseVersion {
+		return nil, ackMiss(j.Status)
+	}
+	return j, nil
+}
+
+func (m *Memory) Extend(ctx context.Context, tenantID, jobID, workerID string, leaseVersion int64, by time.Duration) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.fenced(tenantID, jobID, leaseVersion)
+	if err != nil {
+		return time.Time{}, err
+	}
+	exp := m.now().Add(by.Truncate(time.Second))
+	j.LeaseExpiresAt, j.UpdatedAt = &exp, m.now()
+	m.record(j, domain.EventExtended, map[string]any{
+		"workerId": workerID, "attempt": j.Attempt, "leaseExpiresAt": exp,
+	})
+	return exp, nil
+}
+
+func (m *Memory) Complete(ctx context.Context, tenantID, jobID, workerID string, leaseVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.fenced(tenantID, jobID, leaseVersion)
+	if err != nil {
+		return err
+	}
+	j.Status, j.UpdatedAt = domain.Succeeded, m.now()
+	m.record(j, domain.EventCompleted, map[string]any{"workerId": workerID, "attempt": j.Attempt})
+	return nil
+}
+
+func (m *Memory) Fail(ctx context.Context, f FailParams) (*domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.fenced(f.TenantID, f.JobID, f.LeaseVersion)
+	if err != nil {
+		return nil, err
+	}
+	msg := f.Error
+	j.Error, j.UpdatedAt = &msg, m.now()
+
+	switch {
+	case f.Retryable && j.Attempt+1 < j.MaxAttempts:
+		next := m.now().Add(backoffDelay(j.ID, j.BackoffPolicy, j.Attempt))
+		m.record(j, domain.EventRetried, map[string]any{
+			"workerId": f.WorkerID, "attempt": j.Attempt, "error": f.Error, "nextRunAt": next,
+		})
+		j.Status, j.RunAt = domain.FailedTemp, next
+		j.Attempt++
+		m.push(j)
+	case f.Retryable:
+		reason := fmt.Sprintf("max attempts (%d) exhausted: %s", j.MaxAttempts, f.Error)
+		j.Status, j.LeasedBy, j.LeaseExpiresAt = domain.DeadLettered, nil, nil
+		m.record(j, domain.EventDeadLettered, map[string]any{
+			"workerId": f.WorkerID, "attempt": j.Attempt, "error": f.Error, "reason": reason,
+		})
+	default:
+		j.Status = domain.FailedPerm
+		m.record(j, domain.EventFailed, map[string]any{
+			"workerId": f.WorkerID, "attempt": j.Attempt, "error": f.Error,
+		})
+	}
+	out := *j
+	return &out, nil
+}
+
+func (m *Memory) ListJobs(ctx context.Context, tenantID string, limit int) ([]domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := m.filter(tenantID, func(*domain.Job) bool { return true })
+	sort.Slice(out, func(a, b int) bool { return m.seq[out[a].ID] > m.seq[out[b].ID] })
+	return out[:min(limit, len(out))], nil
+}
+
+func (m *Memory) JobEvents(ctx context.Context, tenantID, jobID string) ([]domain.JobEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.job(tenantID, jobID) == nil {
+		return nil, ErrJobNotFound
+	}
+	var out []domain.JobEvent
+	for _, e := range m.events {
+		if e.JobID == jobID && e.TenantID == tenantID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) Tenants(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, 0, len(m.tenants))
+	for t := range m.tenants {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (m *Memory) RequeueExpired(ctx context.Context, tenantID string, limit int) ([]domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	expired := m.filter(tenantID, func(j *domain.Job) bool {
+		return j.Status == domain.Leased && j.LeaseExpiresAt != nil && j.LeaseExpiresAt.Before(now)
+	})
+	sort.Slice(expired, func(a, b int) bool { return expired[a].LeaseExpiresAt.Before(*expired[b].LeaseExpiresAt) })
+	expired = expired[:min(limit, len(expired))]
+	for _, e := range expired {
+		j := m.jobs[e.ID]
+		m.record(j, domain.EventLeaseExpired, map[string]any{
+			"workerId": j.LeasedBy, "attempt": j.Attempt, "leaseExpiresAt": j.LeaseExpiresAt,
+		})
+		j.Status, j.LeasedBy, j.LeaseExpiresAt, j.UpdatedAt = domain.Queued, nil, nil, now
+		m.push(j)
+	}
+	return expired, nil
+}
+
+func (m *Memory) Reconcile(ctx context.Context, tenantID, after string, limit int) ([]domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pushing := map[string]bool{}
+	for _, id := range m.outbox {
+		pushing[id] = true
+	}
+	settled := m.now().Add(-ReconcileGrace)
+	out := m.filter(tenantID, func(j *domain.Job) bool {
+		return (j.Status == domain.Queued || j.Status == domain.FailedTemp) &&
+			j.ID > after && j.UpdatedAt.Before(settled) && !pushing[j.ID]
+	})
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out[:min(limit, len(out))], nil
+}
+
+func (m *Memory) RelayOutbox(ctx context.Context, limit int, publish func(domain.Job) error) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for n < len(m.outbox) && n < limit {
+		j, ok := m.jobs[m.outbox[n]]
+		if ok && (j.Status == domain.Queued || j.Status == domain.FailedTemp) {
+			if err := publish(*j); err != nil {
+				m.outbox = m.outbox[n:]
+				return n, err
+			}
+		}
+		n++
+	}
+	m.outbox = m.outbox[n:]
+	return n, nil
+}
+
+// PruneOutbox is a no-op: entries are dropped as soon as they are relayed.
+func (m *Memory) PruneOutbox(ctx context.Context) error { return nil }
+
+// filter returns copies of the tenant's jobs that match keep.
+func (m *Memory) filter(tenantID string, keep func(*domain.Job) bool) []domain.Job {
+	var out []domain.Job
+	for _, j := range m.jobs {
+		if j.TenantID == tenantID && keep(j) {
+			out = append(out, *j)
+		}
+	}
+	return out
+}
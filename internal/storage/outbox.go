@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/SirClappington/enq/internal/domain"
+)
+
+// WriteOutbox records that jobID must be pushed to the queue. Call it with
+// the tx that makes the job ready (insert, retry, requeue, replay), so the
+// push can't be lost if the process dies right after the commit.
+func WriteOutbox(ctx context.Context, db Execer, tenantID, jobID string) error {
+	_, err := db.Exec(ctx, `insert into outbox(tenant_id, job_id) values ($1, $2)`, tenantID, jobID)
+	return err
+}
+
+// outboxRetention is how long sent rows are kept for debugging.
+const outboxRetention = "1 day"
+
+// outboxClaim is how long a relay has to publish the rows it claimed before
+// another relay may take them over.
+const outboxClaim = "30 seconds"
+
+// ReconcileGrace is how long a job must have sat unchanged, with its last
+// push relayed, before Reconcile reports it, so reconcile doesn't race the
+// relay or a lease that is about to commit.
+const ReconcileGrace = 30 * time.Second
+
+func (s *Store) RelayOutbox(ctx context.Context, limit int, publish func(domain.Job) error) (int, error) {
+	// claiming is a statement of its own, so no row locks are held while
+	// publishing; skip locked and the claim keep relays from taking the
+	// same rows
+	rows, err := s.db.Query(ctx,
+		`with claimed as (
+		   update outbox set claimed_until = now() + interval '`+outboxClaim+`'
+		    where id in (select id from outbox
+		                  where sent_at is null and (claimed_until is null or claimed_until < now())
+		                  order by id
+		                  limit $1
+		                    for update skip locked)
+		   returning id, job_id)
+		 select c.id, j.tenant_id, j.id::text, j.type, j.priority, j.run_at, j.status::text
+		   from claimed c join jobs j on j.id = c.job_id
+		  order by c.id`, limit)
+	if err != nil {
+		return 0, err
+	}
+	type entry struct {
+		id  int64
+		job domain.Job
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.job.TenantID, &e.job.ID, &e.job.Type, &e.job.Priority, &e.job.RunAt,
+			&e.job.Status); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	var sent, unsent []int64
+	var pubErr error
+	for _, e := range entries {
+		if pubErr != nil {
+			unsent = append(unsent, e.id)
+			continue
+		}
+		// a job that moved on since (leased from an earlier push, purged
+		// from the DLQ, ...) needs no push
+		if e.job.Status == domain.Queued || e.job.Status == domain.FailedTemp {
+			if pubErr = publish(e.job); pubErr != nil {
+				unsent = append(unsent, e.id)
+				continue
+			}
+		}
+		sent = append(sent, e.id)
+	}
+	// if this fails the rows are published again once the claim runs out,
+	// which the queue's idempotent Enqueue absorbs
+	if _, err := s.db.Exec(ctx,
+		`update outbox
+		    set sent_at = case when id = any($1) then now() end,
+		        claimed_until = null
+		  where id = any($1) or id = any($2)`, sent, unsent); err != nil {
+		return 0, err
+	}
+	return len(sent), pubErr
+}
+
+func (s *Store) PruneOutbox(ctx context.Context) error {
+	_, err := s.db.Exec(ctx,
+		`delete from outbox where sent_at < now() - interval '`+outboxRetention+`'`)
+	return err
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/queue"
+	"github.com/SirClappington/enq/internal/retry"
+)
+
+// Repository is the job store behind the API and the scheduler. Store
+// implements it on Postgres and Memory keeps everything in process.
+type Repository interface {
+	// InsertJob stores a new queued job; see Store.InsertJob for dedupe.
+	InsertJob(ctx context.Context, j *InsertJobParams) (id string, dup bool, err error)
+
+	JobType(ctx context.Context, tenantID, typ string) (*domain.JobType, error)
+	RateLimitedTypes(ctx context.Context, tenantID string) ([]domain.JobType, error)
+	ConcurrencyCaps(ctx context.Context, tenantID string) (ConcurrencyCaps, error)
+	LeasedCounts(ctx context.Context, tenantID string) (map[string]int, error)
+
+	// Lease leases the popped jobs ids to workerID and returns them in ids
+	// order. Jobs that are no longer queued or awaiting retry are skipped.
+	// Jobs that would exceed caps stay queued, go back through the outbox
+	// and are returned in deferred.
+	Lease(ctx context.Context, tenantID, workerID string, ids []string, caps ConcurrencyCaps) (leased, deferred []domain.Job, err error)
+	// Claim leases up to count due jobs straight from the store, in the
+	// order queue.ReadyScore gives run_at and priority with the repository's
+	// starvation bound, honouring f and caps like a queue pop followed by
+	// Lease. It is the lease path of the Postgres-only queue mode.
+	Claim(ctx context.Context, tenantID, workerID string, f queue.Filter, caps ConcurrencyCaps, count int) ([]domain.Job, error)
+	// Ready returns a channel that is closed the next time a job of the
+	// tenant may have become ready to claim. Store needs Listen running for
+	// that; without it the channel never fires.
+	Ready(tenantID string) <-chan struct{}
+	// Extend pushes the lease of a job out to now+by and returns the new
+	// expiry.
+	Extend(ctx context.Context, tenantID, jobID, workerID string, leaseVersion int64, by time.Duration) (time.Time, error)
+	Complete(ctx context.Context, tenantID, jobID, workerID string, leaseVersion int64) error
+	// Fail records a failed attempt. A retryable failure with attempts left
+	// goes to failed_temp with run_at set from the job's backoff policy and
+	// is requeued through the outbox. Otherwise the job ends failed_perm or,
+	// when retryable but out of attempts, dead_lettered.
+	Fail(ctx context.Context, f FailParams) (*domain.Job, error)
+
+	ListJobs(ctx context.Context, tenantID string, limit int) ([]domain.Job, error)
+	// JobEvents returns the job's events, oldest first; jobs created before
+	// events were recorded have none. It fails with ErrJobNotFound if the
+	// tenant has no such job.
+	JobEvents(ctx context.Context, tenantID, jobID string) ([]domain.JobEvent, error)
+
+	Tenants(ctx context.Context) ([]string, error)
+	// RequeueExpired puts up to limit leased jobs whose lease has expired
+	// back to queued, through the outbox, and returns them.
+	RequeueExpired(ctx context.Context, tenantID string, limit int) ([]domain.Job, error)
+	// Reconcile returns up to limit jobs waiting to be leased with IDs
+	// after the cursor after ("" to start over), in ID order, so the caller
+	// can restore any the queue lost. Jobs changed or pushed within
+	// ReconcileGrace are left out: their push may still be on its way.
+	Reconcile(ctx context.Context, tenantID, after string, limit int) ([]domain.Job, error)
+	// RelayOutbox hands up to limit unsent outbox entries, oldest first, to
+	// publish and marks them sent. It stops at the first publish error and
+	// returns how many entries it marked. Entries whose job is no longer
+	// queued or awaiting retry are marked without publishing. A crash after
+	// publishing but before the mark means a second publish, which the
+	// queue backends absorb since Enqueue is idempotent.
+	RelayOutbox(ctx context.Context, limit int, publish func(domain.Job) error) (int, error)
+	// PruneOutbox deletes sent outbox entries past their retention.
+	PruneOutbox(ctx context.Context) error
+}
+
+// Ack errors. Extend, Complete and Fail change nothing when they return one.
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrLeaseLost   = errors.New("lease is no longer held: job was re-leased")
+	ErrNotLeased   = errors.New("lease is no longer held: job is not leased")
+)
+
+type FailParams struct {
+	TenantID, JobID, WorkerID string
+	LeaseVersion              int64
+	Error                     string
+	Retryable                 bool
+}
+
+// backoffDelay is the wait before attempt+1 under policy. Rows written before
+// policies were validated fall back to the default exponential policy.
+func backoffDelay(jobID, policy string, attempt int) time.Duration {
+	p, err := retry.Parse(policy)
+	if err != nil {
+		log.Printf("job %s: bad backoff policy %q, using exponential: %v", jobID, policy, err)
+		p, _ = retry.Parse("exponential")
+	}
+	return p.Delay(attempt)
+}
+
+// ackMiss classifies an ack that matched no row from the job's current state.
+func ackMiss(status domain.Status) error {
+	if status == domain.Leased {
+		return ErrLeaseLost
+	}
+	return ErrNotLeased
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/SirClappington/enq/internal/domain"
+	"github.com/SirClappington/enq/internal/queue"
+)
+
+// testRepo is a Repository under test with a tenant of its own. advance
+// moves the repository's clock forward: Memory's is faked, Store's is the
+// database's, so that one just waits.
+type testRepo struct {
+	Repository
+	tenant  string
+	advance func(time.Duration)
+}
+
+type repoCase struct {
+	name string
+	new  func(t *testing.T) testRepo
+}
+
+// testRepos lists the Repository implementations that must behave alike.
+// Set ENQ_TEST_POSTGRES_DSN to a migrated database to include Store.
+func testRepos() []repoCase {
+	repos := []repoCase{{"memory", newMemoryRepo}}
+	if dsn := os.Getenv("ENQ_TEST_POSTGRES_DSN"); dsn != "" {
+		repos = append(repos, repoCase{"postgres", func(t *testing.T) testRepo { return newPostgresRepo(t, dsn) }})
+	}
+	return repos
+}
+
+func newMemoryRepo(t *testing.T) testRepo {
+	m := NewMemory(time.Minute)
+	clock := time.Now().UTC()
+	m.now = func() time.Time { return clock }
+	m.AddTenant("t1", nil)
+	return testRepo{Repository: m, tenant: "t1", advance: func(d time.Duration) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		clock = clock.Add(d)
+	}}
+}
+
+func newPostgresRepo(t *testing.T, dsn string) testRepo {
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant := "test-" + uuid.NewString()
+	if _, err := db.Exec(ctx, `insert into tenants (id, name, api_key_hash) values ($1, $1, '')`, tenant); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec(context.Background(), `delete from tenants where id = $1`, tenant)
+		db.Close()
+	})
+	return testRepo{Repository: New(db, time.Minute), tenant: tenant, advance: time.Sleep}
+}
+
+func forEachRepo(t *testing.T, test func(t *testing.T, r testRepo)) {
+	for _, r := range testRepos() {
+		t.Run(r.name, func(t *testing.T) { test(t, r.new(t)) })
+	}
+}
+
+func (r testRepo) insert(t *testing.T, maxAttempts, vt int) string {
+	t.Helper()
+	id, _, err := r.InsertJob(context.Background(), &InsertJobParams{
+		TenantID: r.tenant, Type: "a", Payload: []byte(`{}`), Priority: 100, RunAt: time.Now().UTC(),
+		MaxAttempts: maxAttempts, BackoffPolicy: "fixed:1s", VisibilityTimeoutSec: vt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func (r testRepo) lease(t *testing.T, id string) domain.Job {
+	t.Helper()
+	leased, _, err := r.Lease(context.Background(), r.tenant, "w1", []string{id}, ConcurrencyCaps{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leased) != 1 {
+		t.Fatalf("Lease(%s) leased %d jobs", id, len(leased))
+	}
+	return leased[0]
+}
+
+// relayed returns the IDs RelayOutbox publishes now.
+func (r testRepo) relayed(t *testing.T) []string {
+	t.Helper()
+	var ids []string
+	_, err := r.RelayOutbox(context.Background(), 1000, func(j domain.Job) error {
+		if j.TenantID == r.tenant {
+			ids = append(ids, j.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func (r testRepo) events(t *testing.T, id string) []domain.Event {
+	t.Helper()
+	evs, err := r.JobEvents(context.Background(), r.tenant, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]domain.Event, len(evs))
+	for i, e := range evs {
+		out[i] = e.Event
+	}
+	return out
+}
+
+func TestRepositoryRetryThenDeadLetter(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, r testRepo) {
+		ctx := context.Background()
+		id := r.insert(t, 2, 60)
+		if got := r.relayed(t); !slices.Equal(got, []string{id}) {
+			t.Fatalf("relayed %v after insert", got)
+		}
+
+		j := r.lease(t, id)
+		if j.Attempt != 0 || j.LeaseVersion != 1 {
+			t.Fatalf("first lease: attempt %d, version %d", j.Attempt, j.LeaseVersion)
+		}
+		failed, err := r.Fail(ctx, FailParams{TenantID: r.tenant, JobID: id, WorkerID: "w1",
+			LeaseVersion: j.LeaseVersion, Error: "boom", Retryable: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.Status != domain.FailedTemp || failed.Attempt != 1 {
+			t.Fatalf("after a retryable failure: %s, attempt %d", failed.Status, failed.Attempt)
+		}
+		if got := r.relayed(t); !slices.Equal(got, []string{id}) {
+			t.Fatalf("relayed %v after the retry", got)
+		}
+
+		// not due before its backoff has passed
+		claimed, err := r.Claim(ctx, r.tenant, "w1", queue.Filter{}, ConcurrencyCaps{}, 10)
+		if err != nil || len(claimed) != 0 {
+			t.Fatalf("claim during backoff = %d jobs, %v", len(claimed), err)
+		}
+		r.advance(1100 * time.Millisecond)
+		claimed, err = r.Claim(ctx, r.tenant, "w1", queue.Filter{}, ConcurrencyCaps{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claimed) != 1 || claimed[0].Attempt != 1 || claimed[0].LeaseVersion != 2 {
+			t.Fatalf("claim after backoff = %+v", claimed)
+		}
+
+		failed, err = r.Fail(ctx, FailParams{TenantID: r.tenant, JobID: id, WorkerID: "w1",
+			LeaseVersion: 2, Error: "boom", Retryable: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.Status != domain.DeadLettered {
+			t.Fatalf("out of attempts: %s", failed.Status)
+		}
+		want := []domain.Event{domain.EventEnqueued, domain.EventLeased, domain.EventRetried,
+			domain.EventLeased, domain.EventDeadLettered}
+		if got := r.events(t, id); !slices.Equal(got, want) {
+			t.Errorf("events = %v, want %v", got, want)
+		}
+		if got := r.relayed(t); len(got) != 0 {
+			t.Errorf("relayed %v after dead lettering", got)
+		}
+	})
+}
+
+func TestRepositoryPermanentFailure(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, r testRepo) {
+		id := r.insert(t, 5, 60)
+		j := r.lease(t, id)
+		failed, err := r.Fail(context.Background(), FailParams{TenantID: r.tenant, JobID: id, WorkerID: "w1",
+			LeaseVersion: j.LeaseVersion, Error: "bad input"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.Status != domain.FailedPerm {
+			t.Errorf("status = %s, want %s", failed.Status, domain.FailedPerm)
+		}
+	})
+}
+
+func TestRepositoryFencing(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, r testRepo) {
+		ctx := context.Background()
+		id := r.insert(t, 5, 1)
+		v1 := r.lease(t, id).LeaseVersion
+		if _, err := r.Extend(ctx, r.tenant, id, "w1", v1, time.Second); err != nil {
+			t.Fatalf("Extend with the current version: %v", err)
+		}
+		if err := r.Complete(ctx, r.tenant, id, "w1", v1-1); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("Complete with an old version = %v, want ErrLeaseLost", err)
+		}
+
+		// the lease runs out and another worker takes the job
+		r.advance(1500 * time.Millisecond)
+		if _, err := r.RequeueExpired(ctx, r.tenant, 10); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Complete(ctx, r.tenant, id, "w1", v1); !errors.Is(err, ErrNotLeased) {
+			t.Errorf("Complete of a requeued job = %v, want ErrNotLeased", err)
+		}
+		v2 := r.lease(t, id).LeaseVersion
+		if v2 <= v1 {
+			t.Fatalf("lease version went from %d to %d", v1, v2)
+		}
+		_, err := r.Fail(ctx, FailParams{TenantID: r.tenant, JobID: id, WorkerID: "w1", LeaseVersion: v1, Error: "late"})
+		if !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("Fail by the first worker = %v, want ErrLeaseLost", err)
+		}
+		if _, err := r.Extend(ctx, r.tenant, id, "w1", v1, time.Second); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("Extend by the first worker = %v, want ErrLeaseLost", err)
+		}
+		if err := r.Complete(ctx, r.tenant, id, "w2", v2); err != nil {
+			t.Fatalf("Complete by the second worker: %v", err)
+		}
+		if err := r.Complete(ctx, r.tenant, id, "w2", v2); !errors.Is(err, ErrNotLeased) {
+			t.Errorf("second Complete = %v, want ErrNotLeased", err)
+		}
+
+		if err := r.Complete(ctx, r.tenant, uuid.NewString(), "w1", 1); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Complete of an unknown job = %v, want ErrJobNotFound", err)
+		}
+		if err := r.Complete(ctx, "other", id, "w1", v2); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Complete as another tenant = %v, want ErrJobNotFound", err)
+		}
+	})
+}
+
+func TestRepositoryRequeueExpired(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, r testRepo) {
+		ctx := context.Background()
+		short, long := r.insert(t, 5, 1), r.insert(t, 5, 60)
+		r.relayed(t)
+		r.lease(t, short)
+		r.lease(t, long)
+
+		if got, err := r.RequeueExpired(ctx, r.tenant, 10); err != nil || len(got) != 0 {
+			t.Fatalf("RequeueExpired before expiry = %d jobs, %v", len(got), err)
+		}
+		r.advance(1500 * time.Millisecond)
+		got, err := r.RequeueExpired(ctx, r.tenant, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].ID != short {
+			t.Fatalf("RequeueExpired = %+v, want only %s", got, short)
+		}
+		if got := r.relayed(t); !slices.Equal(got, []string{short}) {
+			t.Errorf("relayed %v, want the requeued job", got)
+		}
+		want := []domain.Event{domain.EventEnqueued, domain.EventLeased, domain.EventLeaseExpired}
+		if got := r.events(t, short); !slices.Equal(got, want) {
+			t.Errorf("events = %v, want %v", got, want)
+		}
+		// the requeued job can be leased again, the other is still held
+		if j := r.lease(t, short); j.LeaseVersion != 2 {
+			t.Errorf("lease version after requeue = %d", j.LeaseVersion)
+		}
+		if leased, _, _ := r.Lease(ctx, r.tenant, "w2", []string{long}, ConcurrencyCaps{}); len(leased) != 0 {
+			t.Error("leased a job that is still leased")
+		}
+	})
+}
@@ -2,27 +2,74 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/SirClappington/enq/internal/domain"
 )
 
-type Store struct{ db *pgxpool.Pool }
+type Store struct {
+	db              *pgxpool.Pool
+	ready           *waker        // fed by Listen
+	starvationBound time.Duration // Claim's priority head start, as in queue.ReadyScore
+}
+
+func New(db *pgxpool.Pool, starvationBound time.Duration) *Store {
+	return &Store{db: db, ready: newWaker(), starvationBound: starvationBound}
+}
+
+// InsertJob persists job metadata (source of truth) and its outbox entry.
+// If DedupeKey is set and the tenant already has a job with that key created
+// within its dedupe TTL (forever when no TTL), nothing is written and the
+// existing job's id is returned with dup=true.
+func (s *Store) InsertJob(ctx context.Context, j *InsertJobParams) (id string, dup bool, err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback(ctx)
 
-func New(db *pgxpool.Pool) *Store { return &Store{db} }
+	if j.DedupeKey != nil {
+		// serialize inserts of the same key, also across API replicas
+		if _, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtextextended($1 || '/' || $2, 0))`,
+			j.TenantID, *j.DedupeKey); err != nil {
+			return "", false, err
+		}
+		err := tx.QueryRow(ctx, `select id::text from jobs
+where tenant_id = $1 and dedupe_key = $2
+  and (dedupe_ttl_sec is null or created_at > now() - dedupe_ttl_sec * interval '1 second')
+order by created_at desc limit 1`, j.TenantID, *j.DedupeKey).Scan(&id)
+		if err == nil {
+			return id, true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return "", false, err
+		}
+	}
 
-// InsertJob persists job metadata (source of truth)
-func (s *Store) InsertJob(ctx context.Context, j *InsertJobParams) (string, error) {
-	id := uuid.NewString()
-	_, err := s.db.Exec(ctx, `insert into jobs(
-id, tenant_id, type, payload, priority, run_at, dedupe_key, dedupe_ttl_sec,
+	id = uuid.NewString()
+	if _, err := tx.Exec(ctx, `insert into jobs(
+id, tenant_id, type, payload, priority, run_at, claim_at, dedupe_key, dedupe_ttl_sec,
 attempt, max_attempts, backoff_policy, visibility_timeout_sec, status
-) values ($1,$2,$3,$4,$5,$6,$7,$8,0,$9,$10,$11,'queued')`,
-		id, j.TenantID, j.Type, j.Payload, j.Priority, j.RunAt, j.DedupeKey, j.DedupeTTL,
-		j.MaxAttempts, j.BackoffPolicy, j.VisibilityTimeoutSec,
-	)
-	return id, err
+) values ($1,$2,$3,$4,$5,$6,$7,$8,$9,0,$10,$11,$12,'queued')`,
+		id, j.TenantID, j.Type, j.Payload, j.Priority, j.RunAt, ClaimAt(j.RunAt, j.Priority, s.starvationBound),
+		j.DedupeKey, j.DedupeTTL, j.MaxAttempts, j.BackoffPolicy, j.VisibilityTimeoutSec,
+	); err != nil {
+		return "", false, err
+	}
+	if err := RecordEvent(ctx, tx, j.TenantID, id, domain.EventEnqueued, map[string]any{
+		"runAt": j.RunAt, "priority": j.Priority, "maxAttempts": j.MaxAttempts,
+	}); err != nil {
+		return "", false, err
+	}
+	if err := WriteOutbox(ctx, tx, j.TenantID, id); err != nil {
+		return "", false, err
+	}
+	return id, false, tx.Commit(ctx)
 }
 
 type InsertJobParams struct {